@@ -0,0 +1,99 @@
+package riago
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// Future represents the pending result of an asynchronous operation.
+type Future struct {
+	done chan struct{}
+	resp proto.Message
+	err  error
+}
+
+// Returns a channel that is closed once the operation has completed.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Waits for the operation to complete and returns its error.
+func (f *Future) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// Waits for the operation to complete and returns its response and error.
+// The response has the same type the synchronous method returns, or is nil
+// for operations without a response.
+func (f *Future) Result() (proto.Message, error) {
+	<-f.done
+	return f.resp, f.err
+}
+
+// SetAsyncLimit bounds the number of asynchronous operations in flight at
+// once. Operations beyond the limit wait for a slot before being issued. A
+// limit of zero (the default) leaves them unbounded, subject to the pool.
+func (c *Client) SetAsyncLimit(n int) {
+	if n <= 0 {
+		c.asyncSlots = nil
+		return
+	}
+
+	c.asyncSlots = make(chan struct{}, n)
+}
+
+// Runs an operation in the background, respecting the async limit.
+func (c *Client) async(fn func() (proto.Message, error)) *Future {
+	f := &Future{done: make(chan struct{})}
+	slots := c.asyncSlots
+
+	go func() {
+		defer close(f.done)
+
+		if slots != nil {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+		}
+
+		f.resp, f.err = fn()
+	}()
+
+	return f
+}
+
+// Performs a Riak Get request asynchronously. The result is a *RpbGetResp.
+func (c *Client) GetAsync(req *RpbGetReq) *Future {
+	return c.async(func() (proto.Message, error) {
+		return c.Get(req)
+	})
+}
+
+// Performs a Riak Put request asynchronously. The result is a *RpbPutResp.
+func (c *Client) PutAsync(req *RpbPutReq) *Future {
+	return c.async(func() (proto.Message, error) {
+		return c.Put(req)
+	})
+}
+
+// Performs a Riak Del request asynchronously. The result is nil.
+func (c *Client) DelAsync(req *RpbDelReq) *Future {
+	return c.async(func() (proto.Message, error) {
+		return nil, c.Del(req)
+	})
+}
+
+// Performs a Riak CRDT Fetch request asynchronously. The result is a
+// *DtFetchResp.
+func (c *Client) DtFetchAsync(req *DtFetchReq) *Future {
+	return c.async(func() (proto.Message, error) {
+		return c.DtFetch(req)
+	})
+}
+
+// Performs a Riak CRDT Update request asynchronously. The result is a
+// *DtUpdateResp.
+func (c *Client) DtUpdateAsync(req *DtUpdateReq) *Future {
+	return c.async(func() (proto.Message, error) {
+		return c.DtUpdate(req)
+	})
+}
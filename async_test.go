@@ -0,0 +1,88 @@
+package riago
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncGet(t *testing.T) {
+	assert := assert.New(t)
+
+	var active, peak int32
+	var mutex sync.Mutex
+
+	handler := func(addr string, code byte, body []byte, reply func(byte, []byte)) {
+		if code != MsgRpbGetReq {
+			reply(code+1, nil)
+			return
+		}
+
+		n := atomic.AddInt32(&active, 1)
+		mutex.Lock()
+		if n > peak {
+			peak = n
+		}
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+
+		req := &RpbGetReq{}
+		proto.Unmarshal(body, req)
+		reply(MsgRpbGetResp, mustMarshal(&RpbGetResp{Vclock: req.GetKey()}))
+	}
+
+	client := NewClientWithDialer("riak", 8, fakeDialer(handler))
+	client.SetAsyncLimit(3)
+
+	profiles := make(chan *Profile, 100)
+	client.SetInstrumenter(func(p *Profile) {
+		profiles <- p
+	})
+
+	n := 30
+	futures := make([]*Future, n)
+	for i := 0; i < n; i++ {
+		futures[i] = client.GetAsync(&RpbGetReq{
+			Bucket: []byte("riago_test"),
+			Key:    []byte(fmt.Sprintf("key_%d", i)),
+		})
+	}
+
+	for i, f := range futures {
+		<-f.Done()
+		resp, err := f.Result()
+		assert.Nil(err)
+		assert.Equal(fmt.Sprintf("key_%d", i), string(resp.(*RpbGetResp).GetVclock()))
+	}
+
+	assert.True(peak <= 3)
+	assert.Equal(n, len(profiles))
+}
+
+func TestAsyncErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := func(addr string, code byte, body []byte, reply func(byte, []byte)) {
+		if code == MsgRpbDelReq {
+			reply(MsgRpbErrorResp, mustMarshal(&RpbErrorResp{Errmsg: []byte("nope"), Errcode: proto.Uint32(1)}))
+			return
+		}
+		reply(code+1, nil)
+	}
+
+	client := NewClientWithDialer("riak", 1, fakeDialer(handler))
+
+	err := client.DelAsync(&RpbDelReq{Bucket: []byte("b"), Key: []byte("k")}).Wait()
+	assert.Equal("nope", err.Error())
+
+	resp, err := client.PutAsync(&RpbPutReq{Bucket: []byte("b"), Content: &RpbContent{Value: []byte("v")}}).Result()
+	assert.Nil(err)
+	assert.IsType(&RpbPutResp{}, resp)
+}
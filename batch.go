@@ -0,0 +1,236 @@
+package riago
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultBatchWaitTimeout is how long a batch writer waits for a connection
+// for each operation unless set otherwise.
+const DefaultBatchWaitTimeout = time.Minute
+
+// DefaultBatchReportInterval is how often a batch writer reports its progress
+// unless set otherwise.
+const DefaultBatchReportInterval = 10 * time.Second
+
+var ErrBatchWriterClosed = errors.New("batch writer closed")
+
+// BatchFailure records a single failed operation of a batch.
+type BatchFailure struct {
+	Op     string // "put" or "del"
+	Bucket string
+	Key    string
+	Err    error
+}
+
+// BatchError is returned by BatchWriter.Close when any operation failed.
+type BatchError struct {
+	Failures []*BatchFailure
+	Total    int
+}
+
+func (e *BatchError) Error() string {
+	f := e.Failures[0]
+	return fmt.Sprintf("%d of %d batch operations failed, first: %s %s/%s: %s", len(e.Failures), e.Total, f.Op, f.Bucket, f.Key, f.Err)
+}
+
+// A queued batch operation; exactly one of put and del is set.
+type batchOp struct {
+	put *RpbPutReq
+	del *RpbDelReq
+}
+
+// BatchWriter executes puts and deletes across the pool with bounded
+// concurrency. Adding an operation blocks while every worker is busy, so
+// producers are slowed to the rate Riak accepts writes. Workers wait for a
+// connection as long as the batch wait timeout (see SetBatchWaitTimeout)
+// rather than failing after the pool wait timeout, so producers block while
+// the pool is exhausted instead of piling up failures.
+type BatchWriter struct {
+	client   *Client
+	ops      chan *batchOp
+	wg       sync.WaitGroup
+	adds     sync.WaitGroup
+	mutex    sync.Mutex
+	closed   bool
+	total    int
+	done     int
+	failures []*BatchFailure
+	prof     *Profile
+	stop     chan struct{}
+}
+
+// SetBatchWaitTimeout establishes how long a batch writer waits for a
+// connection for each operation before recording it as failed with
+// ErrPoolWaitTimeout (DefaultBatchWaitTimeout if zero).
+func (c *Client) SetBatchWaitTimeout(dur time.Duration) {
+	c.batchWait = dur
+}
+
+// SetBatchReportInterval establishes how often a batch writer reports its
+// progress to the instrumenter while open (DefaultBatchReportInterval if
+// zero). A negative interval disables progress reports.
+func (c *Client) SetBatchReportInterval(dur time.Duration) {
+	c.batchReport = dur
+}
+
+// NewBatchWriter creates a batch writer issuing up to concurrency operations
+// at once. Workers beyond the pool size wait for a connection, unless
+// pipelining is enabled (see SetPipelining).
+func (c *Client) NewBatchWriter(concurrency int) (w *BatchWriter) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	w = &BatchWriter{
+		client:   c,
+		ops:      make(chan *batchOp),
+		failures: make([]*BatchFailure, 0),
+		prof:     NewProfile("batch_write", ""),
+		stop:     make(chan struct{}),
+	}
+
+	w.wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go w.work()
+	}
+
+	interval := c.batchReport
+	if interval == 0 {
+		interval = DefaultBatchReportInterval
+	}
+	if interval > 0 {
+		go w.report(interval)
+	}
+
+	return
+}
+
+// Put queues a Riak Put request, blocking until a worker accepts it.
+func (w *BatchWriter) Put(req *RpbPutReq) error {
+	return w.add(&batchOp{put: req})
+}
+
+// Del queues a Riak Del request, blocking until a worker accepts it.
+func (w *BatchWriter) Del(req *RpbDelReq) error {
+	return w.add(&batchOp{del: req})
+}
+
+// Close waits for all queued operations to complete, reports the batch
+// profile to the instrumenter and returns a *BatchError if any failed.
+func (w *BatchWriter) Close() (err error) {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return ErrBatchWriterClosed
+	}
+	w.closed = true
+	w.mutex.Unlock()
+
+	// Operations being added must be sent before the queue is closed.
+	w.adds.Wait()
+	close(w.ops)
+	w.wg.Wait()
+	close(w.stop)
+
+	if len(w.failures) > 0 {
+		err = &BatchError{Failures: w.failures, Total: w.total}
+	}
+
+	w.prof.Count = w.total
+	w.client.instrument(w.prof, err)
+
+	return
+}
+
+// Queues an operation unless the writer is closed.
+func (w *BatchWriter) add(op *batchOp) error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return ErrBatchWriterClosed
+	}
+	w.total += 1
+	w.adds.Add(1)
+	w.mutex.Unlock()
+
+	w.ops <- op
+	w.adds.Done()
+
+	return nil
+}
+
+// Executes queued operations until the writer is closed.
+func (w *BatchWriter) work() {
+	defer w.wg.Done()
+
+	for op := range w.ops {
+		var f *BatchFailure
+
+		if op.put != nil {
+			f = &BatchFailure{Op: "put", Bucket: string(op.put.GetBucket()), Key: string(op.put.GetKey())}
+		} else {
+			f = &BatchFailure{Op: "del", Bucket: string(op.del.GetBucket()), Key: string(op.del.GetKey())}
+		}
+
+		f.Err = w.exec(op)
+
+		w.mutex.Lock()
+		w.done += 1
+		if f.Err != nil {
+			w.failures = append(w.failures, f)
+		}
+		w.mutex.Unlock()
+	}
+}
+
+// Executes an operation, trying again while no connection becomes available
+// until the batch wait timeout has passed.
+func (w *BatchWriter) exec(op *batchOp) (err error) {
+	wait := w.client.batchWait
+	if wait <= 0 {
+		wait = DefaultBatchWaitTimeout
+	}
+	deadline := time.Now().Add(wait)
+
+	for {
+		if op.put != nil {
+			_, err = w.client.Put(op.put)
+		} else {
+			err = w.client.Del(op.del)
+		}
+
+		if err != ErrPoolWaitTimeout || !time.Now().Before(deadline) {
+			return
+		}
+	}
+}
+
+// Reports the operations completed during each interval to the instrumenter
+// as a "batch_write_progress" profile, until the writer is closed.
+func (w *BatchWriter) report(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prof := NewProfile("batch_write_progress", "")
+	last := 0
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mutex.Lock()
+			done := w.done
+			w.mutex.Unlock()
+
+			prof.Count = done - last
+			w.client.instrument(prof, nil)
+
+			prof = NewProfile("batch_write_progress", "")
+			last = done
+		}
+	}
+}
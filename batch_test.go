@@ -0,0 +1,168 @@
+package riago
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	var puts, dels int32
+	handler := func(addr string, code byte, body []byte, reply func(byte, []byte)) {
+		switch code {
+		case MsgRpbPutReq:
+			req := &RpbPutReq{}
+			proto.Unmarshal(body, req)
+			time.Sleep(time.Millisecond)
+
+			if string(req.GetKey()) == "bad" {
+				reply(MsgRpbErrorResp, mustMarshal(&RpbErrorResp{Errmsg: []byte("bad put"), Errcode: proto.Uint32(1)}))
+				return
+			}
+
+			atomic.AddInt32(&puts, 1)
+			reply(MsgRpbPutResp, nil)
+		case MsgRpbDelReq:
+			atomic.AddInt32(&dels, 1)
+			reply(MsgRpbDelResp, nil)
+		default:
+			reply(code+1, nil)
+		}
+	}
+
+	// More workers than connections wait for one
+	client := NewClientWithDialer("riak", 2, fakeDialer(handler))
+	client.SetWaitTimeout(time.Millisecond)
+	client.SetBatchReportInterval(5 * time.Millisecond)
+
+	var prof *Profile
+	var mutex sync.Mutex
+	reports, reported := 0, 0
+	client.SetInstrumenter(func(p *Profile) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch p.Name {
+		case "batch_write":
+			prof = p
+		case "batch_write_progress":
+			reports += 1
+			reported += p.Count
+		}
+	})
+
+	w := client.NewBatchWriter(6)
+
+	n := 50
+	for i := 0; i < n; i++ {
+		err := w.Put(&RpbPutReq{
+			Bucket:  []byte("riago_test"),
+			Key:     []byte(fmt.Sprintf("batch_%d", i)),
+			Content: &RpbContent{Value: []byte("{}")},
+		})
+		assert.Nil(err)
+	}
+
+	w.Put(&RpbPutReq{Bucket: []byte("riago_test"), Key: []byte("bad"), Content: &RpbContent{Value: []byte("{}")}})
+	w.Del(&RpbDelReq{Bucket: []byte("riago_test"), Key: []byte("batch_0")})
+
+	err := w.Close()
+	assert.IsType(&BatchError{}, err)
+
+	batchErr := err.(*BatchError)
+	assert.Equal(1, len(batchErr.Failures))
+	assert.Equal("put", batchErr.Failures[0].Op)
+	assert.Equal("bad", batchErr.Failures[0].Key)
+	assert.Equal(n+2, batchErr.Total)
+
+	assert.Equal(int32(n), puts)
+	assert.Equal(int32(1), dels)
+
+	assert.Equal(n+2, prof.Count)
+	assert.Equal(err, prof.Error)
+
+	// Progress is reported while the writer is open
+	mutex.Lock()
+	assert.True(reports > 0)
+	assert.True(reported <= n+2)
+	mutex.Unlock()
+
+	// Closed writers reject operations
+	assert.Equal(ErrBatchWriterClosed, w.Del(&RpbDelReq{}))
+	assert.Equal(ErrBatchWriterClosed, w.Close())
+}
+
+func TestBatchWriterConcurrentClose(t *testing.T) {
+	assert := assert.New(t)
+
+	client := NewClientWithDialer("riak", 2, fakeDialer(fakeEcho))
+
+	for i := 0; i < 20; i++ {
+		w := client.NewBatchWriter(2)
+
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					if err := w.Del(&RpbDelReq{Bucket: []byte("riago_test"), Key: []byte("k")}); err != nil {
+						assert.Equal(ErrBatchWriterClosed, err)
+						return
+					}
+				}
+			}()
+		}
+
+		time.Sleep(time.Millisecond)
+		assert.Nil(w.Close())
+		wg.Wait()
+	}
+}
+
+func TestBatchWriterUnavailable(t *testing.T) {
+	assert := assert.New(t)
+
+	// Every connection is held, so operations wait for one
+	client := NewClientWithDialer("riak", 1, fakeDialer(fakeEcho))
+	client.SetWaitTimeout(time.Millisecond)
+	client.SetBatchWaitTimeout(time.Second)
+
+	conn, err := client.pool.Get()
+	assert.Nil(err)
+
+	w := client.NewBatchWriter(1)
+	assert.Nil(w.Del(&RpbDelReq{Bucket: []byte("riago_test"), Key: []byte("k")}))
+
+	// Producers block while the worker waits
+	released := make(chan time.Time, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		released <- time.Now()
+		client.pool.Put(conn)
+	}()
+
+	assert.Nil(w.Del(&RpbDelReq{Bucket: []byte("riago_test"), Key: []byte("k")}))
+	assert.False(time.Now().Before(<-released))
+	assert.Nil(w.Close())
+
+	// Operations fail once the batch wait timeout has passed
+	conn, err = client.pool.Get()
+	assert.Nil(err)
+	defer client.pool.Put(conn)
+
+	client.SetBatchWaitTimeout(10 * time.Millisecond)
+	w = client.NewBatchWriter(4)
+	assert.Nil(w.Del(&RpbDelReq{Bucket: []byte("riago_test"), Key: []byte("k")}))
+
+	err = w.Close()
+	assert.IsType(&BatchError{}, err)
+	assert.Equal(ErrPoolWaitTimeout, err.(*BatchError).Failures[0].Err)
+}
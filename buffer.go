@@ -0,0 +1,35 @@
+package riago
+
+import (
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Buffers that grew beyond this size are dropped instead of pooled so a single
+// large object doesn't pin memory for the life of the process.
+const maxPooledBufferSize = 1024 * 1024
+
+// Pool of buffers used to encode requests and read responses.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return proto.NewBuffer(make([]byte, 0, 4096))
+	},
+}
+
+// Gets an empty buffer from the pool.
+func getBuffer() (b *proto.Buffer) {
+	b = bufferPool.Get().(*proto.Buffer)
+	b.Reset()
+
+	return
+}
+
+// Returns a buffer to the pool. The buffer must not be used afterwards.
+func putBuffer(b *proto.Buffer) {
+	if cap(b.Bytes()) > maxPooledBufferSize {
+		return
+	}
+
+	bufferPool.Put(b)
+}
@@ -0,0 +1,146 @@
+package riago
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Call describes a single operation as it passes through the interceptor
+// chain. Interceptors may modify the request before invoking the next
+// interceptor and inspect the response and profile afterwards.
+type Call struct {
+	Op       string        // Operation name, as used for profiles (e.g. "get")
+	Code     byte          // Request message code
+	Req      proto.Message // Request message, may be nil
+	RespCode byte          // Expected response message code
+	Resp     proto.Message // Response message, nil for streaming operations
+	Conn     *Conn         // Connection used by the latest attempt, once made
+	Profile  *Profile
+
+	retry    bool
+	hedge    bool
+	coalesce bool
+	newResp  func() proto.Message
+	isDone   func(proto.Message) bool
+	handle   func(proto.Message) error
+}
+
+// Invoker performs the operation described by a call.
+type Invoker func(call *Call) error
+
+// Interceptor wraps every operation performed by a Client. It may act before
+// and after calling next, or short-circuit the operation by returning without
+// calling next at all.
+type Interceptor func(call *Call, next Invoker) error
+
+// Instrumenter returns an interceptor that completes the profile of every
+// operation and passes it to fn.
+func Instrumenter(fn func(*Profile)) Interceptor {
+	return func(call *Call, next Invoker) (err error) {
+		err = next(call)
+
+		call.Profile.Error = err
+		call.Profile.Total = time.Now().Sub(call.Profile.start)
+		fn(call.Profile)
+
+		return
+	}
+}
+
+// AddInterceptor appends an interceptor to the chain run around every
+// operation. Interceptors run in the order they were added, the first being
+// the outermost. The instrumenter, if set, wraps the whole chain, while
+// compression and encryption (see SetCompression and SetEncryption) run
+// inside it.
+func (c *Client) AddInterceptor(i Interceptor) {
+	c.interceptors = append(c.interceptors, i)
+}
+
+// Create a new call for a single request and response operation, expecting
+// a response with the given code.
+func newCall(op string, object string, code byte, req proto.Message, respCode byte, resp proto.Message) *Call {
+	return &Call{
+		Op:       op,
+		Code:     code,
+		Req:      req,
+		RespCode: respCode,
+		Resp:     resp,
+		Profile:  NewProfile(op, object),
+	}
+}
+
+// Create a new call for a streaming operation. Each response is allocated by
+// newResp, passed to handle, and the stream ends once isDone reports true.
+// Riak answers every streaming request with the request code plus one.
+func newStreamCall(op string, object string, code byte, req proto.Message, newResp func() proto.Message, isDone func(proto.Message) bool, handle func(proto.Message) error) *Call {
+	call := newCall(op, object, code, req, code+1, nil)
+	call.newResp = newResp
+	call.isDone = isDone
+	call.handle = handle
+
+	return call
+}
+
+// Performs an operation through the interceptor chain.
+func (c *Client) exec(call *Call) error {
+	next := c.invoke
+
+	if c.encryption != nil {
+		next = bind(c.encrypt, next)
+	}
+
+	if c.compression != nil {
+		next = bind(c.compress, next)
+	}
+
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		next = bind(c.interceptors[i], next)
+	}
+
+	if c.instrumenter != nil {
+		next = bind(Instrumenter(c.instrumenter), next)
+	}
+
+	return next(call)
+}
+
+// Binds an interceptor to the next invoker in the chain.
+func bind(i Interceptor, next Invoker) Invoker {
+	return func(call *Call) error {
+		return i(call, next)
+	}
+}
+
+// Performs an operation at the end of the interceptor chain, coalescing and
+// retrying it as configured for the call.
+func (c *Client) invoke(call *Call) error {
+	run := func() error {
+		return c.attempt(call)
+	}
+
+	if call.retry {
+		attempt := run
+		run = func() error {
+			return c.retry(attempt, call.Profile)
+		}
+	}
+
+	if call.coalesce {
+		return c.coalesce(call, run)
+	}
+
+	return run()
+}
+
+// Performs a single attempt of an operation.
+func (c *Client) attempt(call *Call) error {
+	switch {
+	case call.newResp != nil:
+		return c.stream(call)
+	case call.hedge:
+		return c.hedge(call)
+	default:
+		return c.do(call)
+	}
+}
@@ -0,0 +1,181 @@
+package riago
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// Echoes the requested key back as the vclock.
+func keyEchoHandler(addr string, code byte, body []byte, reply func(byte, []byte)) {
+	switch code {
+	case MsgRpbGetReq:
+		req := &RpbGetReq{}
+		proto.Unmarshal(body, req)
+		reply(MsgRpbGetResp, mustMarshal(&RpbGetResp{Vclock: req.GetKey()}))
+	case MsgRpbListKeysReq:
+		reply(MsgRpbListKeysResp, mustMarshal(&RpbListKeysResp{Keys: [][]byte{[]byte("a")}, Done: proto.Bool(true)}))
+	default:
+		reply(code+1, nil)
+	}
+}
+
+func TestInterceptorChain(t *testing.T) {
+	assert := assert.New(t)
+
+	client := NewClientWithDialer("riak", 1, fakeDialer(keyEchoHandler))
+
+	order := make([]string, 0)
+	var prof *Profile
+	client.SetInstrumenter(func(p *Profile) {
+		order = append(order, "instrument")
+		prof = p
+	})
+
+	// Key prefixing rewrites the request before it is sent
+	client.AddInterceptor(func(call *Call, next Invoker) error {
+		order = append(order, "prefix")
+		if req, ok := call.Req.(*RpbGetReq); ok {
+			req.Key = append([]byte("tenant:"), req.Key...)
+		}
+		return next(call)
+	})
+
+	// Inner interceptors see the operation, code, connection and response
+	client.AddInterceptor(func(call *Call, next Invoker) error {
+		order = append(order, "inspect")
+		assert.Equal("get", call.Op)
+		assert.Equal(byte(MsgRpbGetReq), call.Code)
+		assert.Nil(call.Conn)
+
+		err := next(call)
+		assert.NotNil(call.Conn)
+		assert.Equal("tenant:k", string(call.Resp.(*RpbGetResp).GetVclock()))
+		assert.Nil(prof)
+		return err
+	})
+
+	resp, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("k")})
+	assert.Nil(err)
+	assert.Equal("tenant:k", string(resp.GetVclock()))
+	assert.Equal([]string{"prefix", "inspect", "instrument"}, order)
+	assert.Equal("get", prof.Name)
+	assert.True(prof.Total > 0)
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	assert := assert.New(t)
+
+	client := NewClientWithDialer("riak", 1, fakeDialer(keyEchoHandler))
+
+	var prof *Profile
+	client.SetInstrumenter(func(p *Profile) {
+		prof = p
+	})
+
+	chaos := errors.New("chaos")
+	client.AddInterceptor(func(call *Call, next Invoker) error {
+		if call.Op == "list_keys" {
+			return chaos
+		}
+		return next(call)
+	})
+
+	// Streaming operations pass through the chain too
+	_, err := client.ListKeys(&RpbListKeysReq{Bucket: []byte("b")})
+	assert.Equal(chaos, err)
+	assert.Equal(chaos, prof.Error)
+	assert.Equal("list_keys", prof.Name)
+
+	err = client.Del(&RpbDelReq{Bucket: []byte("b"), Key: []byte("k")})
+	assert.Nil(err)
+	assert.Nil(prof.Error)
+	assert.Equal("del", prof.Name)
+}
+
+// Answers bucket type requests, which riago does not wrap, and streams two
+// responses for list keys.
+func bucketTypeHandler(addr string, code byte, body []byte, reply func(byte, []byte)) {
+	switch code {
+	case 31: // RpbGetBucketTypeReq
+		req := &RpbGetBucketTypeReq{}
+		proto.Unmarshal(body, req)
+		reply(MsgRpbGetBucketResp, mustMarshal(&RpbGetBucketResp{Props: &RpbBucketProps{Datatype: req.Type}}))
+	case MsgRpbListKeysReq:
+		reply(MsgRpbListKeysResp, mustMarshal(&RpbListKeysResp{Keys: [][]byte{[]byte("a")}}))
+		reply(MsgRpbListKeysResp, mustMarshal(&RpbListKeysResp{Keys: [][]byte{[]byte("b")}, Done: proto.Bool(true)}))
+	default:
+		reply(code+1, nil)
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	assert := assert.New(t)
+
+	client := NewClientWithDialer("riak", 1, fakeDialer(bucketTypeHandler))
+
+	var prof *Profile
+	client.SetInstrumenter(func(p *Profile) {
+		prof = p
+	})
+
+	resp := &RpbGetBucketResp{}
+	err := client.Do(31, &RpbGetBucketTypeReq{Type: []byte("maps")}, MsgRpbGetBucketResp, resp)
+	assert.Nil(err)
+	assert.Equal("maps", string(resp.GetProps().GetDatatype()))
+	assert.Equal("do", prof.Name)
+
+	// Responses with an unexpected code are rejected
+	err = client.Do(31, &RpbGetBucketTypeReq{Type: []byte("maps")}, MsgRpbPutResp, resp)
+	assert.Equal(&ProtocolError{Expected: MsgRpbPutResp, Received: MsgRpbGetBucketResp}, err)
+}
+
+func TestClientStream(t *testing.T) {
+	assert := assert.New(t)
+
+	client := NewClientWithDialer("riak", 1, fakeDialer(bucketTypeHandler))
+
+	keys := make([]string, 0)
+	err := client.Stream(MsgRpbListKeysReq, &RpbListKeysReq{Bucket: []byte("b")}, func() proto.Message {
+		return &RpbListKeysResp{}
+	}, func(resp proto.Message) bool {
+		return resp.(*RpbListKeysResp).GetDone()
+	}, func(resp proto.Message) error {
+		for _, k := range resp.(*RpbListKeysResp).GetKeys() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal([]string{"a", "b"}, keys)
+}
+
+func TestClientProtocolDesync(t *testing.T) {
+	assert := assert.New(t)
+
+	// The first response belongs to some other request
+	var mutex sync.Mutex
+	desynced := false
+	client := NewClientWithDialer("riak", 1, fakeDialer(func(addr string, code byte, body []byte, reply func(byte, []byte)) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if code == MsgRpbGetReq && !desynced {
+			desynced = true
+			reply(MsgRpbPutResp, nil)
+			return
+		}
+		keyEchoHandler(addr, code, body, reply)
+	}))
+
+	_, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("k")})
+	assert.Equal(&ProtocolError{Expected: MsgRpbGetResp, Received: MsgRpbPutResp}, err)
+
+	// The connection is discarded and redialed rather than reused
+	resp, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("k")})
+	assert.Nil(err)
+	assert.Equal("k", string(resp.GetVclock()))
+	assert.Equal(int64(2), client.Stats().Dials)
+}
@@ -0,0 +1,383 @@
+package riago
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// DefaultChunkSize is the chunk size used by a ChunkedStore when none is
+// given, keeping chunks well under the size Riak recommends for objects.
+const DefaultChunkSize = 512 * 1024
+
+// DefaultChunkConcurrency is the number of chunks a ChunkedStore reads or
+// writes at once unless set otherwise.
+const DefaultChunkConcurrency = 4
+
+var (
+	ErrChecksumMismatch = errors.New("chunk checksum mismatch")
+	ErrChunkMissing     = errors.New("chunk missing")
+)
+
+// ChunkManifest describes a value stored as a list of chunks.
+type ChunkManifest struct {
+	Size     int     `json:"size"`
+	Checksum string  `json:"checksum"` // Hex encoded SHA-256 of the value
+	Chunks   []Chunk `json:"chunks"`
+}
+
+// Chunk describes a single chunk of a value.
+type Chunk struct {
+	Key      string `json:"key"`
+	Size     int    `json:"size"`
+	Checksum string `json:"checksum"` // Hex encoded SHA-256 of the chunk
+}
+
+// ChunkedStore stores values too large for a single Riak object. Each value
+// is split into fixed-size chunks stored in the "<bucket>_chunks" bucket of
+// the same bucket type,
+// under keys unique to each write, and a manifest listing them is stored
+// under the value key in the bucket. Chunks orphaned by overwriting or
+// deleting a value are deleted once the manifest has been updated. Manifests
+// are stored with if_not_modified, starting over after a conflict as Update
+// does, so the chunks of a manifest replaced by a concurrent write are still
+// found and deleted.
+type ChunkedStore struct {
+	client      *Client
+	typ         string
+	bucket      string
+	chunkBucket string
+	chunkSize   int
+	concurrency int
+}
+
+// NewChunkedStore creates a chunked store for the given bucket, splitting
+// values into chunks of chunkSize bytes (DefaultChunkSize if zero).
+func (c *Client) NewChunkedStore(bucket string, chunkSize int) *ChunkedStore {
+	return c.NewChunkedStoreType("", bucket, chunkSize)
+}
+
+// NewChunkedStoreType creates a chunked store for the given bucket type and
+// bucket (see NewChunkedStore). An empty type uses the default bucket type.
+func (c *Client) NewChunkedStoreType(typ string, bucket string, chunkSize int) *ChunkedStore {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	return &ChunkedStore{
+		client:      c,
+		typ:         typ,
+		bucket:      bucket,
+		chunkBucket: bucket + "_chunks",
+		chunkSize:   chunkSize,
+		concurrency: DefaultChunkConcurrency,
+	}
+}
+
+// SetConcurrency sets the number of chunks read or written at once.
+func (s *ChunkedStore) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.concurrency = n
+}
+
+// Put stores a value, writing its chunks in parallel before its manifest.
+// Chunks of the value it replaces are then deleted. Should storing the
+// manifest fail in a way that does not prove it was rejected, such as a
+// timeout, the new chunks are left in place as the manifest may reference
+// them.
+func (s *ChunkedStore) Put(key string, value []byte) (err error) {
+	var old []Chunk
+	var id string
+	var unsure bool
+
+	if id, err = writeID(); err != nil {
+		return
+	}
+
+	sum := sha256.Sum256(value)
+	m := &ChunkManifest{Size: len(value), Checksum: hex.EncodeToString(sum[:])}
+
+	for i := 0; i*s.chunkSize < len(value); i++ {
+		end := (i + 1) * s.chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+
+		data := value[i*s.chunkSize : end]
+		sum := sha256.Sum256(data)
+		m.Chunks = append(m.Chunks, Chunk{
+			Key:      fmt.Sprintf("%s:%s:%d", key, id, i),
+			Size:     len(data),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	err = s.parallel(len(m.Chunks), func(i int) error {
+		chunk := m.Chunks[i]
+		_, err := s.client.Put(&RpbPutReq{
+			Type:    s.bucketType(),
+			Bucket:  []byte(s.chunkBucket),
+			Key:     []byte(chunk.Key),
+			Content: &RpbContent{Value: value[i*s.chunkSize : i*s.chunkSize+chunk.Size], ContentType: []byte("application/octet-stream")},
+		})
+		return err
+	})
+
+	if err == nil {
+		if old, unsure, err = s.storeManifest(key, m); unsure {
+			return
+		}
+	}
+
+	// Without a manifest the new chunks are orphans.
+	if err != nil {
+		s.deleteChunks(m.Chunks)
+		return
+	}
+
+	return s.deleteChunks(old)
+}
+
+// Stores the manifest of a value unless the stored manifest was modified
+// since it was read, starting over after a backoff (see SetUpdateBackoff).
+// Returns the chunks of the manifests it replaced and, on failure, whether
+// the manifest may have been stored nonetheless.
+func (s *ChunkedStore) storeManifest(key string, m *ChunkManifest) (old []Chunk, unsure bool, err error) {
+	var obj *Object
+	var req *RpbPutReq
+
+	backoff := s.client.updateBackoff
+	if backoff == nil {
+		backoff = &DefaultUpdateBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		if obj, old, err = s.manifest(key); err != nil {
+			return
+		}
+
+		obj.Siblings = []*Content{&Content{ContentType: "application/json"}}
+		if err = obj.Encode(m); err != nil {
+			return
+		}
+
+		if req, err = obj.putReq(); err != nil {
+			return
+		}
+
+		if len(obj.VClock) > 0 {
+			req.IfNotModified = proto.Bool(true)
+		} else {
+			req.IfNoneMatch = proto.Bool(true)
+		}
+
+		if err = s.client.storeObject(obj, req); err == nil {
+			return
+		}
+
+		// Only an error from Riak proves the manifest was not stored.
+		if _, ok := err.(*RiakError); !ok {
+			unsure = true
+			return
+		}
+
+		if !isUpdateConflict(err) {
+			return
+		}
+
+		if attempt > backoff.Attempts {
+			err = &UpdateConflictError{Type: s.typ, Bucket: s.bucket, Key: key, Attempts: attempt, Err: err}
+			return
+		}
+
+		if delay := backoff.delay(attempt); delay > 0 {
+			<-time.After(delay)
+		}
+	}
+}
+
+// Get reads a value, fetching its chunks in parallel and verifying their
+// checksums. Returns ErrNotFound if there is no value for the key,
+// ErrChunkMissing if any of its chunks does not exist and ErrChecksumMismatch
+// if any of its data is corrupt.
+func (s *ChunkedStore) Get(key string) (value []byte, err error) {
+	var obj *Object
+	m := &ChunkManifest{}
+
+	if obj, err = s.client.FetchObject(&RpbGetReq{Type: s.bucketType(), Bucket: []byte(s.bucket), Key: []byte(key)}); err != nil {
+		return
+	}
+
+	if err = obj.Decode(m); err != nil {
+		return
+	}
+
+	// Sizes are checked before the value is allocated, so a corrupt manifest
+	// cannot claim more memory than its chunks could hold.
+	offsets := make([]int, len(m.Chunks))
+	size := 0
+	for i, chunk := range m.Chunks {
+		if chunk.Size < 0 || chunk.Size > s.chunkSize {
+			err = ErrChecksumMismatch
+			return
+		}
+
+		offsets[i] = size
+		size += chunk.Size
+	}
+
+	if m.Size < 0 || size != m.Size {
+		err = ErrChecksumMismatch
+		return
+	}
+
+	value = make([]byte, m.Size)
+
+	err = s.parallel(len(m.Chunks), func(i int) error {
+		chunk := m.Chunks[i]
+
+		resp, err := s.client.Get(&RpbGetReq{Type: s.bucketType(), Bucket: []byte(s.chunkBucket), Key: []byte(chunk.Key)})
+		if err != nil {
+			return err
+		}
+
+		if len(resp.GetContent()) == 0 {
+			return ErrChunkMissing
+		}
+
+		if len(resp.GetContent()) != 1 {
+			return ErrChecksumMismatch
+		}
+
+		data := resp.GetContent()[0].GetValue()
+		sum := sha256.Sum256(data)
+		if len(data) != chunk.Size || hex.EncodeToString(sum[:]) != chunk.Checksum {
+			return ErrChecksumMismatch
+		}
+
+		copy(value[offsets[i]:], data)
+
+		return nil
+	})
+
+	if err != nil {
+		value = nil
+		return
+	}
+
+	if sum := sha256.Sum256(value); hex.EncodeToString(sum[:]) != m.Checksum {
+		value, err = nil, ErrChecksumMismatch
+	}
+
+	return
+}
+
+// Delete removes a value, deleting its manifest and then its chunks.
+func (s *ChunkedStore) Delete(key string) (err error) {
+	var obj *Object
+	var chunks []Chunk
+
+	if obj, chunks, err = s.manifest(key); err != nil {
+		return
+	}
+
+	if err = s.client.Del(&RpbDelReq{Type: s.bucketType(), Bucket: []byte(s.bucket), Key: []byte(key), Vclock: obj.VClock}); err != nil {
+		return
+	}
+
+	return s.deleteChunks(chunks)
+}
+
+// Fetches the manifest object for a key and the chunks listed by each of its
+// siblings, so that chunks written concurrently are collected too.
+func (s *ChunkedStore) manifest(key string) (obj *Object, chunks []Chunk, err error) {
+	var resp *RpbGetResp
+
+	req := &RpbGetReq{Type: s.bucketType(), Bucket: []byte(s.bucket), Key: []byte(key), Deletedvclock: proto.Bool(true)}
+	if resp, err = s.client.Get(req); err != nil {
+		return
+	}
+
+	obj = newObject(s.typ, s.bucket, key, resp)
+
+	for _, c := range obj.Siblings {
+		m := &ChunkManifest{}
+		if c.Deleted {
+			continue
+		}
+		if err = json.Unmarshal(c.Value, m); err != nil {
+			return
+		}
+		chunks = append(chunks, m.Chunks...)
+	}
+
+	return
+}
+
+// Deletes chunks in parallel, returning the first error.
+func (s *ChunkedStore) deleteChunks(chunks []Chunk) error {
+	return s.parallel(len(chunks), func(i int) error {
+		return s.client.Del(&RpbDelReq{Type: s.bucketType(), Bucket: []byte(s.chunkBucket), Key: []byte(chunks[i].Key)})
+	})
+}
+
+// Returns the bucket type of requests, nil for the default type.
+func (s *ChunkedStore) bucketType() []byte {
+	if s.typ == "" {
+		return nil
+	}
+
+	return []byte(s.typ)
+}
+
+// Calls fn for each index below n with bounded concurrency, returning the
+// first error.
+func (s *ChunkedStore) parallel(n int, fn func(i int) error) (err error) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+
+	slots := make(chan struct{}, s.concurrency)
+
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			if e := fn(i); e != nil {
+				mutex.Lock()
+				if err == nil {
+					err = e
+				}
+				mutex.Unlock()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	return
+}
+
+// Returns a random identifier making the chunk keys of a write unique.
+func writeID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
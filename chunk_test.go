@@ -0,0 +1,242 @@
+package riago
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns the keys stored in a bucket of the fake store.
+func storedKeys(store *fakeStore, bucket string) (keys []string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for k := range store.objects {
+		if strings.HasPrefix(k, bucket+"/") {
+			keys = append(keys, strings.TrimPrefix(k, bucket+"/"))
+		}
+	}
+
+	return
+}
+
+func TestChunkedStore(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 4, fakeDialer(store.handle))
+	chunks := client.NewChunkedStore("files", 10)
+
+	// Missing values are not found
+	_, err := chunks.Get("report")
+	assert.Equal(ErrNotFound, err)
+
+	value := bytes.Repeat([]byte("0123456789"), 2)
+	value = append(value, "abcde"...)
+	assert.Nil(chunks.Put("report", value))
+	assert.Len(storedKeys(store, "files_chunks"), 3)
+
+	m := &ChunkManifest{}
+	assert.Nil(json.Unmarshal(store.get("files", "report")[0].Value, m))
+	assert.Equal(25, m.Size)
+	assert.Len(m.Chunks, 3)
+	assert.Equal(5, m.Chunks[2].Size)
+
+	got, err := chunks.Get("report")
+	assert.Nil(err)
+	assert.Equal(value, got)
+
+	// Overwriting collects the chunks of the previous value
+	assert.Nil(chunks.Put("report", []byte("small")))
+	assert.Len(storedKeys(store, "files_chunks"), 1)
+	assert.Len(store.get("files", "report"), 1)
+
+	got, err = chunks.Get("report")
+	assert.Nil(err)
+	assert.Equal("small", string(got))
+
+	// Empty values have no chunks
+	assert.Nil(chunks.Put("empty", nil))
+	got, err = chunks.Get("empty")
+	assert.Nil(err)
+	assert.Empty(got)
+
+	// Deleting removes the manifest and its chunks
+	assert.Nil(chunks.Delete("report"))
+	assert.Empty(storedKeys(store, "files_chunks"))
+	_, err = chunks.Get("report")
+	assert.Equal(ErrNotFound, err)
+}
+
+func TestChunkedStoreChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+	chunks := client.NewChunkedStore("files", 4)
+	chunks.SetConcurrency(2)
+
+	assert.Nil(chunks.Put("report", []byte("corrupt me")))
+
+	keys := storedKeys(store, "files_chunks")
+	assert.Len(keys, 3)
+	store.get("files_chunks", keys[0])[0].Value = []byte("oops")
+
+	_, err := chunks.Get("report")
+	assert.Equal(ErrChecksumMismatch, err)
+
+	// Missing chunks are told apart from corrupt ones
+	store.mutex.Lock()
+	delete(store.objects, "files_chunks/"+keys[0])
+	store.mutex.Unlock()
+
+	_, err = chunks.Get("report")
+	assert.Equal(ErrChunkMissing, err)
+
+	// Manifests with sizes out of range are rejected before reading chunks
+	for _, m := range []*ChunkManifest{
+		{Size: 1 << 30, Chunks: []Chunk{{Key: keys[1], Size: 1 << 30}}},
+		{Size: 4, Chunks: []Chunk{{Key: keys[1], Size: 8}, {Key: keys[2], Size: -4}}},
+		{Size: -1},
+	} {
+		data, _ := json.Marshal(m)
+		store.seed("files", "bogus", &RpbContent{Value: data, ContentType: []byte("application/json")})
+
+		_, err = chunks.Get("bogus")
+		assert.Equal(ErrChecksumMismatch, err)
+	}
+}
+
+func TestChunkedStoreConcurrentPut(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+	client.SetUpdateBackoff(&ExponentialBackoff{Attempts: 2})
+	chunks := client.NewChunkedStore("files", 4)
+
+	// Another writer stores a manifest before this one does
+	raced := false
+	client.AddInterceptor(func(call *Call, next Invoker) error {
+		if req, ok := call.Req.(*RpbPutReq); ok && string(req.Bucket) == "files" && !raced {
+			raced = true
+			m, _ := json.Marshal(&ChunkManifest{Chunks: []Chunk{{Key: "other"}}})
+			store.seed("files_chunks", "other", &RpbContent{Value: []byte("x")})
+			store.seed("files", "report", &RpbContent{Value: m})
+		}
+		return next(call)
+	})
+
+	assert.Nil(chunks.Put("report", []byte("second")))
+	assert.True(raced)
+
+	// The manifest of the other writer is replaced and its chunk collected
+	assert.Len(store.get("files", "report"), 1)
+	assert.Len(storedKeys(store, "files_chunks"), 2)
+
+	got, err := chunks.Get("report")
+	assert.Nil(err)
+	assert.Equal("second", string(got))
+}
+
+func TestChunkedStoreManifestFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+	chunks := client.NewChunkedStore("files", 4)
+
+	var fail error
+	client.AddInterceptor(func(call *Call, next Invoker) error {
+		if req, ok := call.Req.(*RpbPutReq); ok && string(req.Bucket) == "files" && fail != nil {
+			if _, ok := fail.(*RiakError); ok {
+				return fail
+			}
+			next(call)
+			return fail
+		}
+		return next(call)
+	})
+
+	// Chunks of a manifest rejected by Riak are deleted
+	fail = &RiakError{Message: "bad manifest"}
+	assert.Equal(fail, chunks.Put("report", []byte("rejected")))
+	assert.Empty(storedKeys(store, "files_chunks"))
+
+	// A manifest may have been stored despite a lost response, so its
+	// chunks are kept
+	fail = io.ErrUnexpectedEOF
+	assert.Equal(fail, chunks.Put("report", []byte("stored")))
+	assert.Len(storedKeys(store, "files_chunks"), 2)
+
+	fail = nil
+	got, err := chunks.Get("report")
+	assert.Nil(err)
+	assert.Equal("stored", string(got))
+}
+
+func TestChunkedStoreSiblings(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+	chunks := client.NewChunkedStore("files", 4)
+
+	assert.Nil(chunks.Put("report", []byte("first value")))
+
+	// A concurrent writer without the vclock creates a sibling manifest
+	m, _ := json.Marshal(&ChunkManifest{Chunks: []Chunk{{Key: "orphan"}}})
+	store.seed("files_chunks", "orphan", &RpbContent{Value: []byte("x")})
+	_, err := client.Put(&RpbPutReq{Bucket: []byte("files"), Key: []byte("report"), Content: &RpbContent{Value: m}})
+	assert.Nil(err)
+
+	_, err = chunks.Get("report")
+	assert.Equal(ErrUnresolvedSiblings, err)
+
+	// Overwriting replaces both siblings and collects the chunks of each
+	assert.Nil(chunks.Put("report", []byte("second")))
+	assert.Len(store.get("files", "report"), 1)
+	assert.Len(storedKeys(store, "files_chunks"), 2)
+
+	got, err := chunks.Get("report")
+	assert.Nil(err)
+	assert.Equal("second", string(got))
+}
+
+func TestChunkedStoreType(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+	chunks := client.NewChunkedStoreType("blobs", "files", 4)
+
+	// Manifests and chunks are read and written in the bucket type
+	var mutex sync.Mutex
+	types := make(map[string]bool)
+	client.AddInterceptor(func(call *Call, next Invoker) error {
+		mutex.Lock()
+		switch req := call.Req.(type) {
+		case *RpbGetReq:
+			types[string(req.GetType())] = true
+		case *RpbPutReq:
+			types[string(req.GetType())] = true
+		case *RpbDelReq:
+			types[string(req.GetType())] = true
+		}
+		mutex.Unlock()
+		return next(call)
+	})
+
+	assert.Nil(chunks.Put("report", []byte("typed value")))
+	got, err := chunks.Get("report")
+	assert.Nil(err)
+	assert.Equal("typed value", string(got))
+	assert.Nil(chunks.Delete("report"))
+
+	assert.Equal(map[string]bool{"blobs": true}, types)
+}
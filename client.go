@@ -1,6 +1,9 @@
 package riago
 
 import (
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -8,34 +11,101 @@ import (
 
 // Client represents a Riak client instance.
 type Client struct {
-	pool          *Pool
-	retryAttempts int
-	retryDelay    time.Duration
-	readTimeout   time.Duration
-	writeTimeout  time.Duration
-	instrumenter  func(*Profile)
+	pool             *Pool
+	retryAttempts    int
+	retryDelay       time.Duration
+	retryPolicy      RetryPolicy
+	retryPolicies    map[string]RetryPolicy
+	retryBudget      *RetryBudget
+	retryUnsafe      bool
+	hedgeDelay       time.Duration
+	pipelines        []*pipeline
+	pipelineNext     uint32
+	asyncSlots       chan struct{}
+	coalescing       bool
+	flights          map[string]*flight
+	flightMutex      sync.Mutex
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+	maxFrameSize     int
+	instrumenter     func(*Profile)
+	interceptors     []Interceptor
+	resolvers        map[string]ConflictResolver
+	resolveWriteBack bool
+	updateBackoff    *ExponentialBackoff
+	compression      map[string]*Compression
+	encryption       map[string]*Encryption
+	filterDeleted    bool
+	batchWait        time.Duration
+	batchReport      time.Duration
 }
 
 // NewClient creates a new Riago client with a given address and pool count.
 func NewClient(addr string, count int) (c *Client) {
+	return NewClientWithDialer(addr, count, nil)
+}
+
+// NewClientWithDialer creates a new Riago client with a given address, pool
+// count and custom dial function (see DialFunc).
+func NewClientWithDialer(addr string, count int, dial DialFunc) (c *Client) {
+	return NewClientWithPool(NewPoolWithDialer(addr, count, dial))
+}
+
+// NewClusterClient creates a new Riago client with connections spread across
+// multiple Riak nodes.
+func NewClusterClient(addrs []string, count int) (c *Client) {
+	return NewClientWithPool(NewClusterPool(addrs, count, nil))
+}
+
+// NewClientWithPool creates a new Riago client using an existing pool.
+func NewClientWithPool(p *Pool) (c *Client) {
 	return &Client{
-		pool:          NewPool(addr, count),
+		pool:          p,
 		retryAttempts: 0,
 		retryDelay:    500 * time.Millisecond,
 	}
 }
 
 // SetRetryAttempts sets the number of times an operation will be retried before
-// returning an error.
+// returning an error. Only used when no retry policy is set.
 func (c *Client) SetRetryAttempts(n int) {
 	c.retryAttempts = n
 }
 
-// SetRetryDelay sets the delay between retries.
+// SetRetryDelay sets the delay between retries. Only used when no retry policy
+// is set.
 func (c *Client) SetRetryDelay(dur time.Duration) {
 	c.retryDelay = dur
 }
 
+// SetRetryPolicy sets the policy deciding whether and when failed operations
+// are retried. It takes precedence over the retry attempts and delay.
+func (c *Client) SetRetryPolicy(p RetryPolicy) {
+	c.retryPolicy = p
+}
+
+// SetOperationRetryPolicy overrides the retry policy for a single operation,
+// identified by its profile name (e.g. "get", "put", "dt_update").
+func (c *Client) SetOperationRetryPolicy(op string, p RetryPolicy) {
+	if c.retryPolicies == nil {
+		c.retryPolicies = make(map[string]RetryPolicy)
+	}
+	c.retryPolicies[op] = p
+}
+
+// SetRetryBudget establishes a budget shared by all operations that limits
+// how many retries may be issued relative to successful operations.
+func (c *Client) SetRetryBudget(b *RetryBudget) {
+	c.retryBudget = b
+}
+
+// SetRetryNonIdempotent allows operations that are not idempotent (such as
+// Put and DtUpdate) to be retried even when the failed request may already
+// have been written to and applied by Riak.
+func (c *Client) SetRetryNonIdempotent(enabled bool) {
+	c.retryUnsafe = enabled
+}
+
 // SetReadTimeout establishes a timeout deadline for all connection reads.
 func (c *Client) SetReadTimeout(dur time.Duration) {
 	c.readTimeout = dur
@@ -46,43 +116,161 @@ func (c *Client) SetWriteTimeout(dur time.Duration) {
 	c.writeTimeout = dur
 }
 
+// SetMaxFrameSize establishes the largest message in bytes that will be sent
+// to or accepted from Riak. Defaults to DefaultMaxFrameSize.
+func (c *Client) SetMaxFrameSize(n int) {
+	c.maxFrameSize = n
+}
+
+// Returns the maximum frame size for the client.
+func (c *Client) frameLimit() int {
+	if c.maxFrameSize > 0 {
+		return c.maxFrameSize
+	}
+
+	return DefaultMaxFrameSize
+}
+
 // SetWaitTimeout establishes a timeout deadline for how long to wait for
 // a connection to become available from the pool before returning an error.
 func (c *Client) SetWaitTimeout(dur time.Duration) {
 	c.pool.waitTimeout = dur
 }
 
+// SetHedgeDelay enables hedged reads for Get and DtFetch: if a read has not
+// completed within the given delay, an identical read is issued on an idle
+// connection (preferably to another node) and the first response wins. A
+// delay of zero disables hedging. Reads are not hedged while pipelining is
+// enabled (see SetPipelining).
+func (c *Client) SetHedgeDelay(dur time.Duration) {
+	c.hedgeDelay = dur
+}
+
+// SetPipelining enables pipelined mode, where requests are no longer given
+// exclusive use of a pooled connection. Instead, sockets are opened across the
+// pool addresses, conns in total, and up to depth concurrent requests are
+// written to each socket, with responses matched to requests in order. Hedged
+// reads (see SetHedgeDelay) are disabled while pipelining. A count of zero
+// disables pipelining and closes the pipelined sockets.
+func (c *Client) SetPipelining(conns int, depth int) {
+	for _, p := range c.pipelines {
+		p.close()
+	}
+	c.pipelines = nil
+
+	if conns <= 0 {
+		return
+	}
+
+	c.pipelines = make([]*pipeline, conns)
+	for i := range c.pipelines {
+		c.pipelines[i] = newPipeline(c.pool.addrs[i%len(c.pool.addrs)], c.pool.dial, depth)
+	}
+}
+
 // SetInstrumenter establishes an instrument function to be called after each
-// operation and given a payload of operation profile data.
+// operation and given a payload of operation profile data. The instrument
+// function runs as the outermost interceptor (see Instrumenter).
 func (c *Client) SetInstrumenter(fn func(*Profile)) {
 	c.instrumenter = fn
 }
 
+// Stats returns a snapshot of the underlying connection pool statistics.
+func (c *Client) Stats() PoolStats {
+	return c.pool.Stats()
+}
+
 // Performs a Riak Server info request.
 func (c *Client) ServerInfo() (resp *RpbGetServerInfoResp, err error) {
-	prof := NewProfile("server_info", "")
-	defer c.instrument(prof, err)
-
 	resp = &RpbGetServerInfoResp{}
-	err = c.do(MsgRpbGetServerInfoReq, nil, resp, prof)
+	err = c.exec(newCall("server_info", "", MsgRpbGetServerInfoReq, nil, MsgRpbGetServerInfoResp, resp))
 
 	return
 }
 
+// Do performs an arbitrary request with a single response, such as a message
+// riago does not wrap. The response must carry respCode or be a Riak error;
+// any other code returns a *ProtocolError. The response is unmarshaled into
+// resp, which may be nil to discard it. Requests are retried according to the
+// retry policy for the "do" operation and, as they may not be idempotent, are
+// not retried once written unless SetRetryNonIdempotent is enabled.
+func (c *Client) Do(code byte, req proto.Message, respCode byte, resp proto.Message) error {
+	call := newCall("do", "", code, req, respCode, resp)
+	call.retry = true
+
+	return c.exec(call)
+}
+
+// Stream performs an arbitrary request with a stream of responses. Each
+// response is allocated by newResp and passed to handle, and the stream ends
+// once isDone reports true. As with every streaming Riak message, responses
+// must carry the request code plus one. Streams are never retried.
+func (c *Client) Stream(code byte, req proto.Message, newResp func() proto.Message, isDone func(proto.Message) bool, handle func(proto.Message) error) error {
+	return c.exec(newStreamCall("stream", "", code, req, newResp, isDone, handle))
+}
+
 // Performs a single request with a single response
-func (c *Client) do(code byte, req proto.Message, resp proto.Message, prof *Profile) (err error) {
+func (c *Client) do(call *Call) (err error) {
+	if c.pipelines != nil {
+		pcall := &pipelineCall{expect: call.RespCode, resp: call.Resp}
+		if call.Resp != nil {
+			// Decode into a fresh message so a timed out call's response is
+			// never written once its caller has moved on.
+			typ := reflect.TypeOf(call.Resp).Elem()
+			pcall.next = func() proto.Message { return reflect.New(typ).Interface().(proto.Message) }
+		}
+
+		return c.pipelined(call, pcall)
+	}
+
+	err = c.with(func(conn *Conn) error {
+		call.Conn = conn
+		return c.exchange(conn, call.Code, call.Req, call.RespCode, call.Resp, call.Profile)
+	}, call.Profile)
+
+	return
+}
+
+// Performs a single request with a stream of responses.
+func (c *Client) stream(call *Call) (err error) {
+	if c.pipelines != nil {
+		return c.pipelined(call, &pipelineCall{
+			expect: call.RespCode,
+			next:   call.newResp,
+			isDone: call.isDone,
+			handle: call.handle,
+		})
+	}
+
+	prof := call.Profile
+
 	err = c.with(func(conn *Conn) (e error) {
+		call.Conn = conn
+
 		t := time.Now()
-		if e = conn.request(code, req); e != nil {
+		if e = conn.request(call.Code, call.Req); e != nil {
 			return
 		}
 		prof.Request = time.Now().Sub(t)
 
-		t = time.Now()
-		if e = conn.response(resp); e != nil {
-			return
+		for {
+			// Receive the next response
+			resp := call.newResp()
+			t = time.Now()
+			if e = conn.response(call.RespCode, resp); e != nil {
+				return
+			}
+			prof.Response += time.Now().Sub(t)
+
+			if e = call.handle(resp); e != nil {
+				return
+			}
+
+			// Stop receiving responses if the server tells us we're done
+			if call.isDone(resp) {
+				break
+			}
 		}
-		prof.Response = time.Now().Sub(t)
 
 		return
 	}, prof)
@@ -90,6 +278,29 @@ func (c *Client) do(code byte, req proto.Message, resp proto.Message, prof *Prof
 	return
 }
 
+// Writes a single request and reads a single response on a locked connection.
+func (c *Client) exchange(conn *Conn, code byte, req proto.Message, respCode byte, resp proto.Message, prof *Profile) (err error) {
+	t := time.Now()
+	if err = conn.request(code, req); err != nil {
+		return
+	}
+	prof.Request = time.Now().Sub(t)
+
+	t = time.Now()
+	if err = conn.response(respCode, resp); err != nil {
+		return
+	}
+	prof.Response = time.Now().Sub(t)
+
+	return
+}
+
+// Performs a request on the next pipelined connection.
+func (c *Client) pipelined(call *Call, pcall *pipelineCall) error {
+	n := atomic.AddUint32(&c.pipelineNext, 1)
+	return c.pipelines[n%uint32(len(c.pipelines))].call(c, call, pcall)
+}
+
 // Gets and prepares a connection, yields it to the given function and returns the error.
 func (c *Client) with(fn func(*Conn) error, prof *Profile) (err error) {
 	var conn *Conn
@@ -100,14 +311,22 @@ func (c *Client) with(fn func(*Conn) error, prof *Profile) (err error) {
 	}
 	prof.ConnWait = time.Now().Sub(t)
 
-	t = time.Now()
+	return c.use(conn, fn, prof)
+}
+
+// Prepares a connection checked out of the pool, yields it to the given
+// function and releases it, failing the connection if an error is returned.
+func (c *Client) use(conn *Conn, fn func(*Conn) error, prof *Profile) (err error) {
+	t := time.Now()
 	conn.lock()
 	prof.ConnLock = time.Now().Sub(t)
 
 	conn.readTimeout = c.readTimeout
 	conn.writeTimeout = c.writeTimeout
+	conn.maxFrameSize = c.maxFrameSize
 
 	if err = fn(conn); err != nil {
+		prof.written = conn.written
 		conn.close()
 		conn.unlock()
 		c.pool.Fail(conn)
@@ -120,23 +339,54 @@ func (c *Client) with(fn func(*Conn) error, prof *Profile) (err error) {
 	return
 }
 
-// Retries a function multiple times until it does not return an error.
+// Retries a function until it does not return an error or the retry policy
+// for the operation gives up.
 func (c *Client) retry(fn func() error, prof *Profile) (err error) {
-	for i := 0; i <= c.retryAttempts; i++ {
-		if i > 0 {
-			prof.Retries += 1
-		}
+	policy := c.retryPolicyFor(prof.Name)
 
+	for attempt := 1; ; attempt++ {
+		prof.written = false
 		if err = fn(); err == nil {
+			if c.retryBudget != nil {
+				c.retryBudget.deposit()
+			}
+			return
+		}
+
+		delay, ok := policy.Retry(prof.Name, attempt, err)
+		if !ok {
+			return
+		}
+
+		if prof.written && !c.retryUnsafe && !isIdempotent(prof.Name) {
+			prof.RetrySkipped = RetrySkippedNotIdempotent
+			return
+		}
+
+		if c.retryBudget != nil && !c.retryBudget.withdraw() {
 			return
 		}
 
-		if c.retryDelay > 0 {
-			<-time.After(c.retryDelay)
+		if delay > 0 {
+			<-time.After(delay)
 		}
+
+		prof.Retries += 1
 	}
+}
 
-	return
+// Returns the retry policy for an operation, falling back to the client
+// policy and finally to the configured retry attempts and delay.
+func (c *Client) retryPolicyFor(op string) RetryPolicy {
+	if p, ok := c.retryPolicies[op]; ok {
+		return p
+	}
+
+	if c.retryPolicy != nil {
+		return c.retryPolicy
+	}
+
+	return &ConstantBackoff{Attempts: c.retryAttempts, Delay: c.retryDelay}
 }
 
 // Send a profile to the instrumenter
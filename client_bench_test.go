@@ -0,0 +1,69 @@
+package riago
+
+import (
+	"testing"
+)
+
+// Serves canned Get and Put responses for benchmarks.
+func benchHandler() fakeHandler {
+	getResp := mustMarshal(&RpbGetResp{
+		Content: []*RpbContent{{
+			Value:       []byte(`{"hello": "world"}`),
+			ContentType: []byte("application/json"),
+		}},
+		Vclock: []byte("a85hYGBgzGDKBVIcypz/fgaUHjmdwZTImMfKsOvL7bN8WQA="),
+	})
+
+	return func(addr string, code byte, body []byte, reply func(byte, []byte)) {
+		switch code {
+		case MsgRpbGetReq:
+			reply(MsgRpbGetResp, getResp)
+		default:
+			reply(code+1, nil)
+		}
+	}
+}
+
+func BenchmarkClientGet(b *testing.B) {
+	addr, stop := fakeListener(benchHandler())
+	defer stop()
+
+	client := NewClient(addr, 1)
+	req := &RpbGetReq{
+		Bucket: []byte("riago_bench"),
+		Key:    []byte("key"),
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Get(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkClientPut(b *testing.B) {
+	addr, stop := fakeListener(benchHandler())
+	defer stop()
+
+	client := NewClient(addr, 1)
+	req := &RpbPutReq{
+		Bucket: []byte("riago_bench"),
+		Key:    []byte("key"),
+		Content: &RpbContent{
+			Value:       []byte(`{"hello": "world"}`),
+			ContentType: []byte("application/json"),
+		},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Put(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,26 +2,20 @@ package riago
 
 // Performs a Riak CRDT Fetch request.
 func (c *Client) DtFetch(req *DtFetchReq) (resp *DtFetchResp, err error) {
-	prof := NewProfile("dt_fetch", string(req.GetBucket()))
-	defer c.instrument(prof, err)
-
 	resp = &DtFetchResp{}
-	err = c.retry(func() error {
-		return c.do(MsgDtFetchReq, req, resp, prof)
-	}, prof)
+	call := newCall("dt_fetch", string(req.GetBucket()), MsgDtFetchReq, req, MsgDtFetchResp, resp)
+	call.retry, call.hedge, call.coalesce = true, true, true
+	err = c.exec(call)
 
 	return
 }
 
 // Performs a Riak CRDT Update request.
 func (c *Client) DtUpdate(req *DtUpdateReq) (resp *DtUpdateResp, err error) {
-	prof := NewProfile("dt_update", string(req.GetBucket()))
-	defer c.instrument(prof, err)
-
 	resp = &DtUpdateResp{}
-	err = c.retry(func() error {
-		return c.do(MsgDtUpdateReq, req, resp, prof)
-	}, prof)
+	call := newCall("dt_update", string(req.GetBucket()), MsgDtUpdateReq, req, MsgDtUpdateResp, resp)
+	call.retry = true
+	err = c.exec(call)
 
 	return
 }
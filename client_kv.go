@@ -1,68 +1,56 @@
 package riago
 
 import (
-	"time"
+	"github.com/golang/protobuf/proto"
 )
 
-// Performs a Riak Get request.
+// Performs a Riak Get request. Tombstone siblings are removed from the
+// response if enabled (see SetFilterDeleted).
 func (c *Client) Get(req *RpbGetReq) (resp *RpbGetResp, err error) {
-	prof := NewProfile("get", string(req.GetBucket()))
-	defer c.instrument(prof, err)
-
 	resp = &RpbGetResp{}
-	err = c.retry(func() error {
-		return c.do(MsgRpbGetReq, req, resp, prof)
-	}, prof)
+	call := newCall("get", string(req.GetBucket()), MsgRpbGetReq, req, MsgRpbGetResp, resp)
+	call.retry, call.hedge, call.coalesce = true, true, true
+	if err = c.exec(call); err == nil && c.filterDeleted {
+		resp.Content = withoutTombstones(resp.Content)
+	}
 
 	return
 }
 
 // Performs a Riak Put request.
 func (c *Client) Put(req *RpbPutReq) (resp *RpbPutResp, err error) {
-	prof := NewProfile("put", string(req.GetBucket()))
-	defer c.instrument(prof, err)
-
 	resp = &RpbPutResp{}
-	err = c.retry(func() error {
-		return c.do(MsgRpbPutReq, req, resp, prof)
-	}, prof)
+	call := newCall("put", string(req.GetBucket()), MsgRpbPutReq, req, MsgRpbPutResp, resp)
+	call.retry = true
+	err = c.exec(call)
 
 	return
 }
 
 // Performs a Riak Del request.
 func (c *Client) Del(req *RpbDelReq) (err error) {
-	prof := NewProfile("del", string(req.GetBucket()))
-	defer c.instrument(prof, err)
-
-	err = c.retry(func() error {
-		return c.do(MsgRpbDelReq, req, nil, prof)
-	}, prof)
+	call := newCall("del", string(req.GetBucket()), MsgRpbDelReq, req, MsgRpbDelResp, nil)
+	call.retry = true
+	err = c.exec(call)
 
 	return
 }
 
 // Perform a Riak Get Bucket request.
 func (c *Client) GetBucket(req *RpbGetBucketReq) (resp *RpbGetBucketResp, err error) {
-	prof := NewProfile("get_bucket", string(req.GetBucket()))
-	defer c.instrument(prof, err)
-
 	resp = &RpbGetBucketResp{}
-	err = c.retry(func() error {
-		return c.do(MsgRpbGetBucketReq, req, resp, prof)
-	}, prof)
+	call := newCall("get_bucket", string(req.GetBucket()), MsgRpbGetBucketReq, req, MsgRpbGetBucketResp, resp)
+	call.retry = true
+	err = c.exec(call)
 
 	return
 }
 
 // Perform a Riak Set Bucket request.
 func (c *Client) SetBucket(req *RpbSetBucketReq) (err error) {
-	prof := NewProfile("set_bucket", string(req.GetBucket()))
-	defer c.instrument(prof, err)
-
-	err = c.retry(func() error {
-		return c.do(MsgRpbSetBucketReq, req, nil, prof)
-	}, prof)
+	call := newCall("set_bucket", string(req.GetBucket()), MsgRpbSetBucketReq, req, MsgRpbSetBucketResp, nil)
+	call.retry = true
+	err = c.exec(call)
 
 	return
 }
@@ -70,50 +58,23 @@ func (c *Client) SetBucket(req *RpbSetBucketReq) (err error) {
 // Perform a Riak List Buckets request. The protobufs say that it will return
 // multiple responses but it in fact does not.
 func (c *Client) ListBuckets(req *RpbListBucketsReq) (resp *RpbListBucketsResp, err error) {
-	prof := NewProfile("list_buckets", "")
-	defer c.instrument(prof, err)
-
 	resp = &RpbListBucketsResp{}
-	err = c.do(MsgRpbListBucketsReq, req, resp, prof)
+	err = c.exec(newCall("list_buckets", "", MsgRpbListBucketsReq, req, MsgRpbListBucketsResp, resp))
 
 	return
 }
 
 // Perform a Riak List Keys request. Returns multiple list keys responses.
 func (c *Client) ListKeys(req *RpbListKeysReq) (resps []*RpbListKeysResp, err error) {
-	prof := NewProfile("list_keys", string(req.GetBucket()))
-	defer c.instrument(prof, err)
-
-	err = c.with(func(conn *Conn) (e error) {
-		// Issue the ListKeys request once
-		t := time.Now()
-		if e = conn.request(MsgRpbListKeysReq, req); e != nil {
-			return
-		}
-		prof.Request = time.Now().Sub(t)
-
-		// MapRed may produce multiple responses
-		resps = make([]*RpbListKeysResp, 0)
-		for {
-			// Receive the next response
-			resp := &RpbListKeysResp{}
-			t = time.Now()
-			if e = conn.response(resp); e != nil {
-				return
-			}
-			prof.Response += time.Now().Sub(t)
-
-			// Add the response to the result
-			resps = append(resps, resp)
-
-			// Stop receiving responses if the server tells us we're done
-			if resp.GetDone() {
-				break
-			}
-		}
-
-		return
-	}, prof)
+	resps = make([]*RpbListKeysResp, 0)
+	err = c.exec(newStreamCall("list_keys", string(req.GetBucket()), MsgRpbListKeysReq, req, func() proto.Message {
+		return &RpbListKeysResp{}
+	}, func(resp proto.Message) bool {
+		return resp.(*RpbListKeysResp).GetDone()
+	}, func(resp proto.Message) error {
+		resps = append(resps, resp.(*RpbListKeysResp))
+		return nil
+	}))
 
 	return
 }
@@ -121,11 +82,8 @@ func (c *Client) ListKeys(req *RpbListKeysReq) (resps []*RpbListKeysResp, err er
 // Perform a Riak Index (2i) request. The protobufs say that it will return
 // multiple responses but it in fact does not.
 func (c *Client) Index(req *RpbIndexReq) (resp *RpbIndexResp, err error) {
-	prof := NewProfile("index", string(req.GetBucket()))
-	defer c.instrument(prof, err)
-
 	resp = &RpbIndexResp{}
-	err = c.do(MsgRpbIndexReq, req, resp, prof)
+	err = c.exec(newCall("index", string(req.GetBucket()), MsgRpbIndexReq, req, MsgRpbIndexResp, resp))
 
 	return
 }
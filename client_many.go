@@ -0,0 +1,125 @@
+package riago
+
+import (
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// DefaultGetManyConcurrency is the number of concurrent gets issued by GetMany
+// when no concurrency is given.
+const DefaultGetManyConcurrency = 10
+
+// GetManyOptions configures a GetMany request.
+type GetManyOptions struct {
+	Type        string     // Bucket type, if any
+	Concurrency int        // Maximum number of gets in flight
+	Request     *RpbGetReq // Template for read options; bucket and key are replaced
+}
+
+// GetManyResult holds the outcome of a single key in a GetMany request.
+type GetManyResult struct {
+	Key      string
+	Resp     *RpbGetResp // Response including the vclock and all siblings
+	NotFound bool
+	Err      error
+}
+
+// GetMany fetches many keys from a bucket using concurrent Riak Get requests
+// with bounded parallelism. It returns a result for every distinct key, each
+// reporting its response, whether it was not found, or its error. An empty
+// list of keys returns an empty result.
+func (c *Client) GetMany(bucket string, keys []string, opts *GetManyOptions) (results map[string]*GetManyResult) {
+	if opts == nil {
+		opts = &GetManyOptions{}
+	}
+
+	n := opts.Concurrency
+	if n <= 0 {
+		n = DefaultGetManyConcurrency
+	}
+
+	results = make(map[string]*GetManyResult, len(keys))
+	for _, key := range keys {
+		results[key] = &GetManyResult{Key: key}
+	}
+
+	if n > len(results) {
+		n = len(results)
+	}
+
+	work := make(chan *GetManyResult)
+	wg := sync.WaitGroup{}
+	wg.Add(n)
+
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				c.getManyOne(bucket, opts, r)
+			}
+		}()
+	}
+
+	for _, r := range results {
+		work <- r
+	}
+	close(work)
+	wg.Wait()
+
+	return
+}
+
+// Performs the get for a single key of a GetMany request.
+func (c *Client) getManyOne(bucket string, opts *GetManyOptions, r *GetManyResult) {
+	req := &RpbGetReq{}
+	if opts.Request != nil {
+		req = proto.Clone(opts.Request).(*RpbGetReq)
+	}
+
+	req.Bucket = []byte(bucket)
+	req.Key = []byte(r.Key)
+	if opts.Type != "" {
+		req.Type = []byte(opts.Type)
+	}
+
+	if r.Resp, r.Err = c.Get(req); r.Err != nil {
+		r.Resp = nil
+		return
+	}
+
+	r.NotFound = len(r.Resp.GetContent()) == 0 && len(r.Resp.GetVclock()) == 0
+}
+
+// GetManyJson is a convenience method that fetches many documents at once
+// using GetMany.
+//
+// It takes a bucket and list of keys and returns a slice of strings that
+// are expected to be JSON-encoded values, in the order of the given keys.
+// Keys that are not found are omitted and the first sibling is used for keys
+// with siblings. Returns the first error encountered, if any.
+func (c *Client) GetManyJson(bucket string, keys []string) (results []string, err error) {
+	many := c.GetMany(bucket, keys, nil)
+
+	results = make([]string, 0, len(many))
+	seen := make(map[string]bool, len(many))
+
+	for _, key := range keys {
+		r := many[key]
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if r.Err != nil {
+			err = r.Err
+			return
+		}
+
+		if content := r.Resp.GetContent(); len(content) > 0 {
+			results = append(results, string(content[0].GetValue()))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,102 @@
+package riago
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves gets for keys "key_N", reporting "missing" as not found and
+// failing "broken".
+func manyHandler(gets *int32) fakeHandler {
+	return func(addr string, code byte, body []byte, reply func(byte, []byte)) {
+		if code != MsgRpbGetReq {
+			reply(code+1, nil)
+			return
+		}
+
+		atomic.AddInt32(gets, 1)
+
+		req := &RpbGetReq{}
+		proto.Unmarshal(body, req)
+
+		switch key := string(req.GetKey()); key {
+		case "missing":
+			reply(MsgRpbGetResp, nil)
+		case "broken":
+			reply(MsgRpbErrorResp, mustMarshal(&RpbErrorResp{Errmsg: []byte("broken"), Errcode: proto.Uint32(1)}))
+		case "siblings":
+			reply(MsgRpbGetResp, mustMarshal(&RpbGetResp{
+				Content: []*RpbContent{{Value: []byte(`{"id": 1}`)}, {Value: []byte(`{"id": 2}`)}},
+				Vclock:  []byte("vclock"),
+			}))
+		default:
+			reply(MsgRpbGetResp, mustMarshal(&RpbGetResp{
+				Content: []*RpbContent{{Value: []byte(fmt.Sprintf(`{"key": %q, "r": %d}`, key, req.GetR()))}},
+				Vclock:  []byte("vclock"),
+			}))
+		}
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	assert := assert.New(t)
+
+	var gets int32
+	client := NewClientWithDialer("riak", 4, fakeDialer(manyHandler(&gets)))
+
+	keys := []string{"key_1", "key_2", "missing", "broken", "siblings", "key_1"}
+	results := client.GetMany("riago_test", keys, &GetManyOptions{
+		Concurrency: 2,
+		Request:     &RpbGetReq{R: proto.Uint32(2)},
+	})
+
+	// Duplicate keys are fetched once
+	assert.Equal(5, len(results))
+	assert.Equal(int32(5), gets)
+
+	assert.Nil(results["key_1"].Err)
+	assert.False(results["key_1"].NotFound)
+	assert.Equal(`{"key": "key_1", "r": 2}`, string(results["key_1"].Resp.GetContent()[0].GetValue()))
+	assert.Equal("vclock", string(results["key_1"].Resp.GetVclock()))
+
+	assert.Nil(results["missing"].Err)
+	assert.True(results["missing"].NotFound)
+
+	assert.NotNil(results["broken"].Err)
+	assert.Nil(results["broken"].Resp)
+
+	assert.Equal(2, len(results["siblings"].Resp.GetContent()))
+}
+
+func TestGetManyEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	var gets int32
+	client := NewClientWithDialer("riak", 1, fakeDialer(manyHandler(&gets)))
+
+	results := client.GetMany("riago_test", []string{}, nil)
+	assert.Equal(0, len(results))
+
+	jsons, err := client.GetManyJson("riago_test", nil)
+	assert.Nil(err)
+	assert.Equal(0, len(jsons))
+	assert.Equal(int32(0), gets)
+}
+
+func TestGetManyJsonKeyOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	var gets int32
+	client := NewClientWithDialer("riak", 2, fakeDialer(manyHandler(&gets)))
+
+	jsons, err := client.GetManyJson("riago_test", []string{"key_2", "missing", "key_1", "key_2"})
+	assert.Nil(err)
+	assert.Equal([]string{`{"key": "key_2", "r": 0}`, `{"key": "key_1", "r": 0}`}, jsons)
+
+	_, err = client.GetManyJson("riago_test", []string{"key_1", "broken"})
+	assert.Equal("broken", err.Error())
+}
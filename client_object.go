@@ -0,0 +1,101 @@
+package riago
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// Fetches an object using a Riak Get request. The object has no siblings if
+// it was not found. Siblings are resolved by the conflict resolver registered
+// for the bucket, if any (see SetConflictResolver); should writing the
+// resolved value back fail, the resolved object is returned with the error.
+func (c *Client) FetchObject(req *RpbGetReq) (obj *Object, err error) {
+	var resp *RpbGetResp
+
+	if resp, err = c.Get(req); err != nil {
+		return
+	}
+
+	obj = newObject(string(req.GetType()), string(req.GetBucket()), string(req.GetKey()), resp)
+	err = c.resolve(obj)
+
+	return
+}
+
+// Fetches an object (see FetchObject) and decodes its value into a pointer
+// (see Object.Decode).
+func (c *Client) FetchValue(req *RpbGetReq, v interface{}) (obj *Object, err error) {
+	if obj, err = c.FetchObject(req); err != nil {
+		return
+	}
+
+	err = obj.Decode(v)
+
+	return
+}
+
+// Encodes a value into an object (see Object.Encode) and stores it (see
+// StoreObject).
+func (c *Client) StoreValue(obj *Object, v interface{}) (err error) {
+	if err = obj.Encode(v); err != nil {
+		return
+	}
+
+	return c.StoreObject(obj)
+}
+
+// Stores an object using a Riak Put request, sending its vclock. The object
+// must not have siblings. On success the object is given the new vclock and,
+// if it had no key, the key assigned by Riak. Should the store create
+// siblings, as when another writer stored the object without this vclock, the
+// object is refetched and given every sibling with the vclock covering them.
+func (c *Client) StoreObject(obj *Object) (err error) {
+	var req *RpbPutReq
+
+	if req, err = obj.putReq(); err != nil {
+		return
+	}
+
+	return c.storeObject(obj, req)
+}
+
+// Performs the Put request for an object and records the new vclock and key,
+// or the siblings the store created.
+func (c *Client) storeObject(obj *Object, req *RpbPutReq) (err error) {
+	var resp *RpbPutResp
+	var get *RpbGetResp
+
+	req.ReturnHead = proto.Bool(true)
+
+	if resp, err = c.Put(req); err != nil {
+		return
+	}
+
+	if len(resp.GetKey()) > 0 {
+		obj.Key = string(resp.GetKey())
+	}
+
+	// The vclock covers siblings that the object does not have, so it is only
+	// taken along with them. Should the refetch fail, the object keeps its
+	// previous vclock so a later store cannot overwrite them.
+	if len(resp.GetContent()) > 1 {
+		getReq := &RpbGetReq{Bucket: []byte(obj.Bucket), Key: []byte(obj.Key)}
+		if obj.Type != "" {
+			getReq.Type = []byte(obj.Type)
+		}
+
+		if get, err = c.Get(getReq); err != nil {
+			return
+		}
+
+		fetched := newObject(obj.Type, obj.Bucket, obj.Key, get)
+		obj.VClock, obj.Siblings = fetched.VClock, fetched.Siblings
+
+		return
+	}
+
+	if len(resp.GetVclock()) > 0 {
+		obj.VClock = resp.GetVclock()
+	}
+
+	return
+}
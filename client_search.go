@@ -2,63 +2,45 @@ package riago
 
 // Perform a Riak Search Query request.
 func (c *Client) SearchQuery(req *RpbSearchQueryReq) (resp *RpbSearchQueryResp, err error) {
-	prof := NewProfile("search_query", string(req.GetIndex()))
-	defer c.instrument(prof, err)
-
 	resp = &RpbSearchQueryResp{}
-	err = c.do(MsgRpbSearchQueryReq, req, resp, prof)
+	err = c.exec(newCall("search_query", string(req.GetIndex()), MsgRpbSearchQueryReq, req, MsgRbpSearchQueryResp, resp))
 
 	return
 }
 
 // Perform a Riak Yokozuna Index Get request.
 func (c *Client) YokozunaIndexGet(req *RpbYokozunaIndexGetReq) (resp *RpbYokozunaIndexGetResp, err error) {
-	prof := NewProfile("yokozuna_index_get", string(req.GetName()))
-	defer c.instrument(prof, err)
-
 	resp = &RpbYokozunaIndexGetResp{}
-	err = c.do(MsgRpbYokozunaIndexGetReq, req, resp, prof)
+	err = c.exec(newCall("yokozuna_index_get", string(req.GetName()), MsgRpbYokozunaIndexGetReq, req, MsgRpbYokozunaIndexGetResp, resp))
 
 	return
 }
 
 // Perform a Riak Yokozuna Index Put request.
 func (c *Client) YokozunaIndexPut(req *RpbYokozunaIndexPutReq) (err error) {
-	prof := NewProfile("yokozuna_index_put", string(req.GetIndex().GetName()))
-	defer c.instrument(prof, err)
-
-	err = c.do(MsgRpbYokozunaIndexPutReq, req, nil, prof)
+	err = c.exec(newCall("yokozuna_index_put", string(req.GetIndex().GetName()), MsgRpbYokozunaIndexPutReq, req, MsgRpbPutResp, nil))
 
 	return
 }
 
 // Perform a Riak Yokozuna Index Delete request.
 func (c *Client) YokozunaIndexDelete(req *RpbYokozunaIndexDeleteReq) (err error) {
-	prof := NewProfile("yokozuna_index_delete", string(req.GetName()))
-	defer c.instrument(prof, err)
-
-	err = c.do(MsgRpbYokozunaIndexDeleteReq, req, nil, prof)
+	err = c.exec(newCall("yokozuna_index_delete", string(req.GetName()), MsgRpbYokozunaIndexDeleteReq, req, MsgRpbDelResp, nil))
 
 	return
 }
 
 // Perform a Riak Yokozuna Index Get request.
 func (c *Client) YokozunaSchemaGet(req *RpbYokozunaSchemaGetReq) (resp *RpbYokozunaSchemaGetResp, err error) {
-	prof := NewProfile("yokozuna_schema_get", string(req.GetName()))
-	defer c.instrument(prof, err)
-
 	resp = &RpbYokozunaSchemaGetResp{}
-	err = c.do(MsgRpbYokozunaSchemaGetReq, req, resp, prof)
+	err = c.exec(newCall("yokozuna_schema_get", string(req.GetName()), MsgRpbYokozunaSchemaGetReq, req, MsgRpbYokozunaSchemaGetResp, resp))
 
 	return
 }
 
 // Perform a Riak Yokozuna Schema Put request.
 func (c *Client) YokozunaSchemaPut(req *RpbYokozunaSchemaPutReq) (err error) {
-	prof := NewProfile("yokozuna_schema_put", string(req.GetSchema().GetName()))
-	defer c.instrument(prof, err)
-
-	err = c.do(MsgRpbYokozunaSchemaPutReq, req, nil, prof)
+	err = c.exec(newCall("yokozuna_schema_put", string(req.GetSchema().GetName()), MsgRpbYokozunaSchemaPutReq, req, MsgRpbPutResp, nil))
 
 	return
 }
@@ -446,3 +446,24 @@ func TestClientGetManyJson(t *testing.T) {
 		assert.Nil(err)
 	}
 }
+
+func genUnionMapRedQuery(bucket string, keys []string) (query string) {
+	query = `{"inputs":`
+
+	if len(keys) == 0 {
+		query += `"` + bucket + `"`
+	} else {
+		query += `[`
+		for i, key := range keys {
+			if i > 0 {
+				query += `,`
+			}
+			query += `["` + bucket + `", "` + key + `"]`
+		}
+		query += `]`
+	}
+
+	query += `,"query": [{"map":{"language":"erlang","module":"riak_kv_mapreduce","function":"map_object_value"}},{"reduce":{"language":"erlang","module":"riak_kv_mapreduce","function":"reduce_set_union"}}]}`
+
+	return
+}
@@ -0,0 +1,86 @@
+package riago
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// An in-flight read shared by concurrent callers.
+type flight struct {
+	done chan struct{}
+	resp proto.Message
+	err  error
+}
+
+// SetCoalescing enables request coalescing for Get and DtFetch: concurrent
+// callers issuing an identical request (same bucket type, bucket, key and
+// read options) share a single round trip to Riak. Each caller receives its
+// own deep copy of the response.
+func (c *Client) SetCoalescing(enabled bool) {
+	c.flightMutex.Lock()
+	defer c.flightMutex.Unlock()
+
+	c.coalescing = enabled
+	if c.flights == nil {
+		c.flights = make(map[string]*flight)
+	}
+}
+
+// Performs a read through fn, sharing it with any identical read already in
+// flight when coalescing is enabled.
+func (c *Client) coalesce(call *Call, fn func() error) (err error) {
+	var key []byte
+
+	c.flightMutex.Lock()
+	enabled := c.coalescing
+	c.flightMutex.Unlock()
+
+	if !enabled {
+		return fn()
+	}
+
+	// The encoded request identifies the bucket type, bucket, key and
+	// every read option.
+	if key, err = proto.Marshal(call.Req); err != nil {
+		return fn()
+	}
+	key = append(key, call.Code)
+
+	c.flightMutex.Lock()
+	if f, ok := c.flights[string(key)]; ok {
+		c.flightMutex.Unlock()
+
+		<-f.done
+		call.Profile.Coalesced = true
+
+		return f.copy(call.Resp)
+	}
+
+	f := &flight{done: make(chan struct{})}
+	c.flights[string(key)] = f
+	c.flightMutex.Unlock()
+
+	// Followers copy from a snapshot so the leader owns its response.
+	if f.err = fn(); f.err == nil {
+		f.resp = proto.Clone(call.Resp)
+	}
+
+	c.flightMutex.Lock()
+	delete(c.flights, string(key))
+	c.flightMutex.Unlock()
+	close(f.done)
+
+	return f.err
+}
+
+// Copies the shared response into a caller's response, returning the shared
+// error.
+func (f *flight) copy(resp proto.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	resp.Reset()
+	proto.Merge(resp, f.resp)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package riago
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalescedGet(t *testing.T) {
+	assert := assert.New(t)
+
+	var gets int32
+	handler := func(addr string, code byte, body []byte, reply func(byte, []byte)) {
+		if code != MsgRpbGetReq {
+			reply(code+1, nil)
+			return
+		}
+
+		atomic.AddInt32(&gets, 1)
+		time.Sleep(50 * time.Millisecond)
+
+		req := &RpbGetReq{}
+		proto.Unmarshal(body, req)
+		reply(MsgRpbGetResp, mustMarshal(&RpbGetResp{
+			Content: []*RpbContent{{Value: []byte("value")}},
+			Vclock:  req.GetKey(),
+		}))
+	}
+
+	client := NewClientWithDialer("riak", 10, fakeDialer(handler))
+	client.SetCoalescing(true)
+
+	var coalesced int32
+	client.SetInstrumenter(func(p *Profile) {
+		if p.Coalesced {
+			atomic.AddInt32(&coalesced, 1)
+		}
+	})
+
+	n := 10
+	resps := make([]*RpbGetResp, n)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var err error
+			resps[i], err = client.Get(&RpbGetReq{Bucket: []byte("riago_test"), Key: []byte("hot")})
+			assert.Nil(err)
+		}(i)
+	}
+
+	// A read with different options is not shared
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := client.Get(&RpbGetReq{Bucket: []byte("riago_test"), Key: []byte("hot"), R: proto.Uint32(1)})
+		assert.Nil(err)
+	}()
+
+	wg.Wait()
+
+	assert.Equal(int32(2), gets)
+	assert.Equal(int32(n-1), coalesced)
+
+	// Callers can't mutate each other's responses
+	resps[0].GetContent()[0].Value[0] = 'V'
+	resps[0].Vclock = []byte("mine")
+	for _, resp := range resps[1:] {
+		assert.Equal("value", string(resp.GetContent()[0].GetValue()))
+		assert.Equal("hot", string(resp.GetVclock()))
+	}
+}
@@ -0,0 +1,355 @@
+package riago
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNotFound      = errors.New("object not found")
+	ErrInvalidTarget = errors.New("target must be a pointer to a struct or a slice of structs")
+)
+
+// Codec encodes and decodes object values of a single content type.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// A struct field tagged for Riak, e.g. `riak:"key"`, `riak:"meta=owner"` or
+// `riak:"index=email_bin"`. Options may be combined with commas.
+type taggedField struct {
+	index []int
+	key   bool
+	meta  string
+	names []string // Secondary index names
+}
+
+// MarshalContent encodes a struct, or a pointer to one, into Riak content
+// using the given codec (JSON if nil). Fields tagged `riak:"meta=name"` are
+// copied into user metadata and fields tagged `riak:"index=name_bin"` (or
+// "_int") into secondary indexes, with slices adding one index value per
+// element. The value of the field tagged `riak:"key"`, if any, is returned
+// as the key. Tagged fields may be strings, byte slices, integers or booleans.
+func MarshalContent(codec Codec, v interface{}) (key string, content *RpbContent, err error) {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() != reflect.Struct {
+		err = ErrInvalidTarget
+		return
+	}
+
+	key, content, _, err = marshalValue(codec, v)
+
+	return
+}
+
+// Encodes a value into Riak content, copying tagged fields if the value is a
+// struct. Returns the tagged fields so callers can replace stale metadata.
+func marshalValue(codec Codec, v interface{}) (key string, content *RpbContent, fields []taggedField, err error) {
+	var value []byte
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Struct {
+		if fields, err = taggedFields(rv.Type()); err != nil {
+			return
+		}
+	}
+
+	if value, err = codec.Marshal(v); err != nil {
+		return
+	}
+
+	content = &RpbContent{Value: value, ContentType: []byte(codec.ContentType())}
+
+	for _, tf := range fields {
+		var values []string
+		if values, err = fieldStrings(rv.FieldByIndex(tf.index)); err != nil {
+			return
+		}
+
+		if tf.key && len(values) > 0 {
+			key = values[0]
+		}
+
+		if tf.meta != "" && len(values) > 0 {
+			content.Usermeta = append(content.Usermeta, &RpbPair{Key: []byte(tf.meta), Value: []byte(values[0])})
+		}
+
+		for _, name := range tf.names {
+			for _, s := range values {
+				content.Indexes = append(content.Indexes, &RpbPair{Key: []byte(name), Value: []byte(s)})
+			}
+		}
+	}
+
+	return
+}
+
+// UnmarshalContent decodes Riak content into a pointer to a struct using the
+// given codec, or the codec registered for its content type if nil (see
+// RegisterCodec), then sets tagged fields from the user metadata, secondary
+// indexes and the given key.
+func UnmarshalContent(codec Codec, key string, content *RpbContent, v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return ErrInvalidTarget
+	}
+
+	if codec == nil {
+		if codec, err = LookupCodec(string(content.GetContentType())); err != nil {
+			return
+		}
+	}
+
+	return unmarshalValue(codec, key, content, v)
+}
+
+// Decodes Riak content into a pointer, setting tagged fields if it points to
+// a struct.
+func unmarshalValue(codec Codec, key string, content *RpbContent, v interface{}) (err error) {
+	var fields []taggedField
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		return ErrInvalidTarget
+	}
+	rv = rv.Elem()
+
+	if rv.Kind() == reflect.Struct {
+		if fields, err = taggedFields(rv.Type()); err != nil {
+			return
+		}
+	}
+
+	if err = codec.Unmarshal(content.GetValue(), v); err != nil {
+		return
+	}
+
+	for _, tf := range fields {
+		values := make([]string, 0)
+
+		if tf.key {
+			values = append(values, key)
+		}
+
+		if tf.meta != "" {
+			for _, p := range content.GetUsermeta() {
+				if string(p.GetKey()) == tf.meta {
+					values = append(values, string(p.GetValue()))
+				}
+			}
+		}
+
+		for _, name := range tf.names {
+			for _, p := range content.GetIndexes() {
+				if string(p.GetKey()) == name {
+					values = append(values, string(p.GetValue()))
+				}
+			}
+		}
+
+		if len(values) > 0 {
+			if err = setFieldStrings(rv.FieldByIndex(tf.index), values); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// UnmarshalGetResp decodes a Riak Get response for the given key using the
+// given codec, or the codec registered for the content type of each sibling
+// if nil. The target may be a pointer to a struct, in
+// which case the object must not have siblings, or a pointer to a slice of
+// structs (or struct pointers) receiving every sibling. Tombstones are
+// skipped and ErrNotFound is returned if no value remains.
+func UnmarshalGetResp(codec Codec, key string, resp *RpbGetResp, v interface{}) (err error) {
+	content := make([]*RpbContent, 0, len(resp.GetContent()))
+	for _, c := range resp.GetContent() {
+		if !c.GetDeleted() {
+			content = append(content, c)
+		}
+	}
+
+	if len(content) == 0 {
+		return ErrNotFound
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		return ErrInvalidTarget
+	}
+
+	if rv.Elem().Kind() != reflect.Slice {
+		if len(content) > 1 {
+			return ErrUnresolvedSiblings
+		}
+
+		return UnmarshalContent(codec, key, content[0], v)
+	}
+
+	slice := rv.Elem()
+	elem := slice.Type().Elem()
+	isPtr := elem.Kind() == reflect.Ptr
+	if isPtr {
+		elem = elem.Elem()
+	}
+
+	if elem.Kind() != reflect.Struct {
+		return ErrInvalidTarget
+	}
+
+	result := reflect.MakeSlice(slice.Type(), 0, len(content))
+	for _, c := range content {
+		item := reflect.New(elem)
+		if err = UnmarshalContent(codec, key, c, item.Interface()); err != nil {
+			return
+		}
+
+		if isPtr {
+			result = reflect.Append(result, item)
+		} else {
+			result = reflect.Append(result, item.Elem())
+		}
+	}
+	slice.Set(result)
+
+	return
+}
+
+// Returns the fields of a struct type carrying a riak tag.
+func taggedFields(t reflect.Type) (fields []taggedField, err error) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag, ok := f.Tag.Lookup("riak")
+		if !ok || tag == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		tf := taggedField{index: f.Index}
+		for _, opt := range strings.Split(tag, ",") {
+			switch {
+			case opt == "":
+			case opt == "key":
+				tf.key = true
+			case strings.HasPrefix(opt, "meta="):
+				tf.meta = strings.TrimPrefix(opt, "meta=")
+			case strings.HasPrefix(opt, "index="):
+				tf.names = append(tf.names, strings.TrimPrefix(opt, "index="))
+			default:
+				err = fmt.Errorf("riago: invalid tag option %q on field %s", opt, f.Name)
+				return
+			}
+		}
+
+		fields = append(fields, tf)
+	}
+
+	return
+}
+
+// Returns the string representations of a field value, one per element for
+// slices other than byte slices.
+func fieldStrings(f reflect.Value) (values []string, err error) {
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < f.Len(); i++ {
+			var s string
+			if s, err = fieldString(f.Index(i)); err != nil {
+				return
+			}
+			values = append(values, s)
+		}
+		return
+	}
+
+	var s string
+	if s, err = fieldString(f); err != nil {
+		return
+	}
+
+	return []string{s}, nil
+}
+
+// Returns the string representation of a scalar field value.
+func fieldString(f reflect.Value) (string, error) {
+	switch f.Kind() {
+	case reflect.String:
+		return f.String(), nil
+	case reflect.Slice:
+		if f.Type().Elem().Kind() == reflect.Uint8 {
+			return string(f.Bytes()), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(f.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(f.Uint(), 10), nil
+	case reflect.Bool:
+		return strconv.FormatBool(f.Bool()), nil
+	}
+
+	return "", fmt.Errorf("riago: unsupported field type %s", f.Type())
+}
+
+// Sets a field from string representations, all of them for slices other
+// than byte slices and the first otherwise.
+func setFieldStrings(f reflect.Value, values []string) error {
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(f.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setFieldString(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		f.Set(slice)
+
+		return nil
+	}
+
+	return setFieldString(f, values[0])
+}
+
+// Sets a scalar field from its string representation.
+func setFieldString(f reflect.Value, s string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+		return nil
+	case reflect.Slice:
+		if f.Type().Elem().Kind() == reflect.Uint8 {
+			f.SetBytes([]byte(s))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+		return nil
+	}
+
+	return fmt.Errorf("riago: unsupported field type %s", f.Type())
+}
@@ -0,0 +1,93 @@
+package riago
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+type codecUser struct {
+	ID     string   `json:"-" riak:"key"`
+	Email  string   `json:"email" riak:"index=email_bin"`
+	Age    int      `json:"age" riak:"index=age_int"`
+	Owner  string   `json:"-" riak:"meta=owner"`
+	Groups []string `json:"groups" riak:"index=group_bin"`
+	Admin  bool     `json:"admin" riak:"meta=admin,index=admin_bin"`
+}
+
+func TestCodecMarshalContent(t *testing.T) {
+	assert := assert.New(t)
+
+	user := &codecUser{ID: "bob", Email: "bob@example.com", Age: 42, Owner: "alice", Groups: []string{"a", "b"}}
+	key, content, err := MarshalContent(nil, user)
+	assert.Nil(err)
+	assert.Equal("bob", key)
+	assert.Equal("application/json", string(content.ContentType))
+	assert.JSONEq(`{"email":"bob@example.com","age":42,"groups":["a","b"],"admin":false}`, string(content.Value))
+	assert.Equal([]*RpbPair{
+		{Key: []byte("owner"), Value: []byte("alice")},
+		{Key: []byte("admin"), Value: []byte("false")},
+	}, content.Usermeta)
+	assert.Equal([]*RpbPair{
+		{Key: []byte("email_bin"), Value: []byte("bob@example.com")},
+		{Key: []byte("age_int"), Value: []byte("42")},
+		{Key: []byte("group_bin"), Value: []byte("a")},
+		{Key: []byte("group_bin"), Value: []byte("b")},
+		{Key: []byte("admin_bin"), Value: []byte("false")},
+	}, content.Indexes)
+
+	// Round trips through a get response
+	var decoded codecUser
+	err = UnmarshalGetResp(nil, key, &RpbGetResp{Content: []*RpbContent{content}}, &decoded)
+	assert.Nil(err)
+	assert.Equal(*user, decoded)
+
+	_, _, err = MarshalContent(nil, "string")
+	assert.Equal(ErrInvalidTarget, err)
+
+	_, _, err = MarshalContent(nil, &struct {
+		Name string `riak:"bogus"`
+	}{})
+	assert.NotNil(err)
+
+	_, _, err = MarshalContent(nil, &struct {
+		Score float64 `riak:"index=score_int"`
+	}{})
+	assert.NotNil(err)
+}
+
+func TestCodecUnmarshalSiblings(t *testing.T) {
+	assert := assert.New(t)
+
+	resp := &RpbGetResp{Content: []*RpbContent{
+		{Value: []byte(`{"email":"a@example.com"}`), Usermeta: []*RpbPair{{Key: []byte("owner"), Value: []byte("alice")}}},
+		{Value: []byte{}, Deleted: proto.Bool(true)},
+		{Value: []byte(`{"email":"b@example.com"}`), Indexes: []*RpbPair{{Key: []byte("age_int"), Value: []byte("7")}}},
+	}}
+
+	// Siblings cannot be decoded into a single struct
+	var user codecUser
+	assert.Equal(ErrUnresolvedSiblings, UnmarshalGetResp(nil, "bob", resp, &user))
+
+	// Slices receive every live sibling
+	var users []codecUser
+	assert.Nil(UnmarshalGetResp(nil, "bob", resp, &users))
+	assert.Equal([]codecUser{
+		{ID: "bob", Email: "a@example.com", Owner: "alice"},
+		{ID: "bob", Email: "b@example.com", Age: 7},
+	}, users)
+
+	var ptrs []*codecUser
+	assert.Nil(UnmarshalGetResp(nil, "bob", resp, &ptrs))
+	assert.Len(ptrs, 2)
+	assert.Equal("b@example.com", ptrs[1].Email)
+
+	// Tombstones and missing objects are not found
+	assert.Equal(ErrNotFound, UnmarshalGetResp(nil, "bob", &RpbGetResp{Content: resp.Content[1:2]}, &user))
+	assert.Equal(ErrNotFound, UnmarshalGetResp(nil, "bob", &RpbGetResp{}, &users))
+
+	var names []string
+	assert.Equal(ErrInvalidTarget, UnmarshalGetResp(nil, "bob", resp, &names))
+	assert.Equal(ErrInvalidTarget, UnmarshalGetResp(nil, "bob", resp, user))
+}
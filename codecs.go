@@ -0,0 +1,179 @@
+package riago
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	ErrUnknownContentType = errors.New("no codec registered for content type")
+	ErrUnsupportedValue   = errors.New("value not supported by codec")
+)
+
+var (
+	codecs = map[string]Codec{
+		"application/json":         JSONCodec{},
+		"application/x-protobuf":   ProtobufCodec{},
+		"application/x-msgpack":    MsgpackCodec{},
+		"application/msgpack":      MsgpackCodec{},
+		"application/octet-stream": RawCodec{},
+		"text/plain":               TextCodec{},
+	}
+	codecsMutex sync.RWMutex
+)
+
+// RegisterCodec makes a codec available for the given content type, replacing
+// any codec previously registered for it.
+func RegisterCodec(contentType string, codec Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+
+	codecs[normalizeContentType(contentType)] = codec
+}
+
+// LookupCodec returns the codec registered for a content type, ignoring any
+// parameters such as the charset. An empty content type returns JSONCodec.
+func LookupCodec(contentType string) (Codec, error) {
+	contentType = normalizeContentType(contentType)
+	if contentType == "" {
+		return JSONCodec{}, nil
+	}
+
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	if codec, ok := codecs[contentType]; ok {
+		return codec, nil
+	}
+
+	return nil, ErrUnknownContentType
+}
+
+// Returns the lower case media type of a content type without parameters.
+func normalizeContentType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// JSONCodec encodes values as JSON. It is the default codec.
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec encodes protocol buffer messages.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	if msg, ok := v.(proto.Message); ok {
+		return proto.Marshal(msg)
+	}
+
+	return nil, ErrUnsupportedValue
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	if msg, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, msg)
+	}
+
+	return ErrUnsupportedValue
+}
+
+// MsgpackCodec encodes values as MessagePack.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) ContentType() string {
+	return "application/x-msgpack"
+}
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// RawCodec stores byte slices as is.
+type RawCodec struct{}
+
+func (RawCodec) ContentType() string {
+	return "application/octet-stream"
+}
+
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case *[]byte:
+		return *b, nil
+	}
+
+	return nil, ErrUnsupportedValue
+}
+
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	if b, ok := v.(*[]byte); ok {
+		*b = append([]byte(nil), data...)
+		return nil
+	}
+
+	return ErrUnsupportedValue
+}
+
+// TextCodec stores strings and byte slices as plain text.
+type TextCodec struct{}
+
+func (TextCodec) ContentType() string {
+	return "text/plain"
+}
+
+func (TextCodec) Marshal(v interface{}) ([]byte, error) {
+	switch s := v.(type) {
+	case string:
+		return []byte(s), nil
+	case *string:
+		return []byte(*s), nil
+	case []byte:
+		return s, nil
+	case *[]byte:
+		return *s, nil
+	}
+
+	return nil, ErrUnsupportedValue
+}
+
+func (TextCodec) Unmarshal(data []byte, v interface{}) error {
+	switch s := v.(type) {
+	case *string:
+		*s = string(data)
+		return nil
+	case *[]byte:
+		*s = append([]byte(nil), data...)
+		return nil
+	}
+
+	return ErrUnsupportedValue
+}
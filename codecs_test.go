@@ -0,0 +1,155 @@
+package riago
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Encodes strings upper cased, for registry tests.
+type upperCodec struct{}
+
+func (upperCodec) ContentType() string {
+	return "application/x-upper"
+}
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	return bytes.ToUpper([]byte(v.(string))), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*string) = string(bytes.ToLower(data))
+	return nil
+}
+
+func TestCodecsLookup(t *testing.T) {
+	assert := assert.New(t)
+
+	codec, err := LookupCodec("")
+	assert.Nil(err)
+	assert.Equal(JSONCodec{}, codec)
+
+	codec, err = LookupCodec("Text/Plain; charset=utf-8")
+	assert.Nil(err)
+	assert.Equal(TextCodec{}, codec)
+
+	codec, err = LookupCodec("application/msgpack")
+	assert.Nil(err)
+	assert.Equal(MsgpackCodec{}, codec)
+
+	_, err = LookupCodec("application/x-upper")
+	assert.Equal(ErrUnknownContentType, err)
+
+	// The registry is global, so the codec is unregistered after the test
+	t.Cleanup(func() {
+		codecsMutex.Lock()
+		delete(codecs, "application/x-upper")
+		codecsMutex.Unlock()
+	})
+
+	RegisterCodec("application/x-upper", upperCodec{})
+	codec, err = LookupCodec("application/x-upper")
+	assert.Nil(err)
+	assert.Equal(upperCodec{}, codec)
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	type point struct {
+		X int
+		Y int
+	}
+
+	for _, codec := range []Codec{JSONCodec{}, MsgpackCodec{}} {
+		buf, err := codec.Marshal(&point{X: 1, Y: 2})
+		assert.Nil(err)
+		var p point
+		assert.Nil(codec.Unmarshal(buf, &p))
+		assert.Equal(point{X: 1, Y: 2}, p)
+	}
+
+	buf, err := ProtobufCodec{}.Marshal(&RpbPair{Key: []byte("k"), Value: []byte("v")})
+	assert.Nil(err)
+	pair := &RpbPair{}
+	assert.Nil(ProtobufCodec{}.Unmarshal(buf, pair))
+	assert.Equal("v", string(pair.Value))
+	_, err = ProtobufCodec{}.Marshal(&point{})
+	assert.Equal(ErrUnsupportedValue, err)
+
+	buf, err = RawCodec{}.Marshal([]byte{0, 1})
+	assert.Nil(err)
+	var raw []byte
+	assert.Nil(RawCodec{}.Unmarshal(buf, &raw))
+	assert.Equal([]byte{0, 1}, raw)
+	_, err = RawCodec{}.Marshal("string")
+	assert.Equal(ErrUnsupportedValue, err)
+
+	buf, err = TextCodec{}.Marshal("hello")
+	assert.Nil(err)
+	var text string
+	assert.Nil(TextCodec{}.Unmarshal(buf, &text))
+	assert.Equal("hello", text)
+	assert.Equal(ErrUnsupportedValue, TextCodec{}.Unmarshal(buf, &point{}))
+}
+
+func TestCodecsObjectEncodeDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	// Tagged fields replace stale metadata and indexes
+	obj := NewObject("users", "")
+	obj.Content().AddBinIndex("email", "old@example.com")
+	obj.Content().AddBinIndex("other", "kept")
+	assert.Nil(obj.Encode(&codecUser{ID: "bob", Email: "bob@example.com", Owner: "alice"}))
+	assert.Equal("bob", obj.Key)
+	assert.Equal("application/json", obj.Content().ContentType)
+	assert.Equal([]string{"bob@example.com"}, obj.Content().BinIndex("email"))
+	assert.Equal([]string{"kept"}, obj.Content().BinIndex("other"))
+
+	var user codecUser
+	assert.Nil(obj.Decode(&user))
+	assert.Equal(codecUser{ID: "bob", Email: "bob@example.com", Owner: "alice"}, user)
+
+	// The content type selects the codec
+	obj = NewObject("users", "bob")
+	obj.Content().ContentType = "application/x-msgpack"
+	assert.Nil(obj.Encode(&codecUser{Email: "bob@example.com"}))
+	user = codecUser{}
+	assert.Nil(obj.Decode(&user))
+	assert.Equal("bob@example.com", user.Email)
+	assert.Equal("bob", user.ID)
+
+	obj.Content().ContentType = "application/x-unknown"
+	assert.Equal(ErrUnknownContentType, obj.Decode(&user))
+
+	obj.Siblings = nil
+	assert.Equal(ErrNotFound, obj.Decode(&user))
+}
+
+func TestClientFetchStoreValue(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+
+	// Values written by other clients decode by content type
+	store.seed("greetings", "hello", &RpbContent{Value: []byte("Hello"), ContentType: []byte("text/plain; charset=utf-8")})
+	var greeting string
+	_, err := client.FetchValue(&RpbGetReq{Bucket: []byte("greetings"), Key: []byte("hello")}, &greeting)
+	assert.Nil(err)
+	assert.Equal("Hello", greeting)
+
+	obj := NewObject("users", "")
+	assert.Nil(client.StoreValue(obj, &codecUser{ID: "bob", Email: "bob@example.com"}))
+	assert.Equal("application/json", string(store.get("users", "bob")[0].ContentType))
+
+	var user codecUser
+	obj, err = client.FetchValue(&RpbGetReq{Bucket: []byte("users"), Key: []byte("bob")}, &user)
+	assert.Nil(err)
+	assert.Equal("bob@example.com", user.Email)
+	assert.Equal("bob", user.ID)
+
+	_, err = client.FetchValue(&RpbGetReq{Bucket: []byte("users"), Key: []byte("carol")}, &user)
+	assert.Equal(ErrNotFound, err)
+}
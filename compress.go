@@ -0,0 +1,303 @@
+package riago
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	ErrUnknownEncoding      = errors.New("no compressor registered for content encoding")
+	ErrDecompressedTooLarge = errors.New("decompressed value exceeds size limit")
+)
+
+// Compressor compresses and decompresses object values for a single content
+// encoding.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	// Decompress returns ErrDecompressedTooLarge rather than produce more
+	// than limit bytes.
+	Decompress(data []byte, limit int) ([]byte, error)
+}
+
+// Compression configures the compression of values stored in a bucket.
+type Compression struct {
+	Encoding string // Content encoding, e.g. "gzip", "snappy" or "zstd"
+	MinSize  int    // Values smaller than this are stored uncompressed
+}
+
+var (
+	compressors = map[string]Compressor{
+		"gzip":   gzipCompressor{},
+		"snappy": snappyCompressor{},
+		"zstd":   &zstdCompressor{},
+	}
+	compressorsMutex sync.RWMutex
+)
+
+// RegisterCompressor makes a compressor available for the given content
+// encoding, replacing any compressor previously registered for it.
+func RegisterCompressor(encoding string, c Compressor) {
+	compressorsMutex.Lock()
+	defer compressorsMutex.Unlock()
+
+	compressors[encoding] = c
+}
+
+// Returns the compressor registered for a content encoding, if any.
+func lookupCompressor(encoding string) Compressor {
+	compressorsMutex.RLock()
+	defer compressorsMutex.RUnlock()
+
+	return compressors[encoding]
+}
+
+// SetCompression compresses values stored with Put in the given bucket type
+// and bucket, setting their content encoding. An empty bucket applies to
+// every bucket of the type without its own configuration and a nil
+// configuration removes it. Once any compression is configured, values read
+// with Get (or returned by Put) in any bucket are decompressed whenever a
+// compressor is registered for their content encoding, up to the maximum
+// frame size (see SetMaxFrameSize).
+func (c *Client) SetCompression(typ string, bucket string, cfg *Compression) (err error) {
+	if cfg != nil && lookupCompressor(cfg.Encoding) == nil {
+		return ErrUnknownEncoding
+	}
+
+	if c.compression == nil {
+		c.compression = make(map[string]*Compression)
+	}
+
+	if cfg == nil {
+		delete(c.compression, typ+"/"+bucket)
+	} else {
+		c.compression[typ+"/"+bucket] = cfg
+	}
+
+	return
+}
+
+// Returns the compression configured for a bucket type and bucket, if any.
+func (c *Client) compressionFor(typ string, bucket string) *Compression {
+	if cfg, ok := c.compression[typ+"/"+bucket]; ok {
+		return cfg
+	}
+
+	return c.compression[typ+"/"]
+}
+
+// Compresses put requests and decompresses the values of responses. Runs
+// inside the interceptors added with AddInterceptor so they see uncompressed
+// values, and around encryption so values are compressed before they are
+// encrypted.
+func (c *Client) compress(call *Call, next Invoker) (err error) {
+	var ratio compressionRatio
+
+	if req, ok := call.Req.(*RpbPutReq); ok {
+		if call.Req, err = c.compressPut(req, &ratio); err != nil {
+			call.Req = req
+			return
+		}
+		defer func() { call.Req = req }()
+	}
+
+	if err = next(call); err == nil {
+		switch resp := call.Resp.(type) {
+		case *RpbGetResp:
+			err = decompressContent(resp.Content, c.frameLimit(), &ratio)
+		case *RpbPutResp:
+			err = decompressContent(resp.Content, c.frameLimit(), &ratio)
+		}
+	}
+
+	call.Profile.CompressionRatio = ratio.value()
+
+	return
+}
+
+// Returns a copy of a put request with its value compressed, or the request
+// itself if the bucket is not configured for compression, the value is
+// already encoded, too small or does not shrink.
+func (c *Client) compressPut(req *RpbPutReq, ratio *compressionRatio) (*RpbPutReq, error) {
+	cfg := c.compressionFor(string(req.GetType()), string(req.GetBucket()))
+	if cfg == nil || req.Content == nil || len(req.Content.ContentEncoding) > 0 || len(req.Content.Value) < cfg.MinSize {
+		return req, nil
+	}
+
+	compressor := lookupCompressor(cfg.Encoding)
+	if compressor == nil {
+		return nil, ErrUnknownEncoding
+	}
+
+	value, err := compressor.Compress(req.Content.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value) >= len(req.Content.Value) {
+		return req, nil
+	}
+
+	ratio.add(len(value), len(req.Content.Value))
+
+	content := *req.Content
+	content.Value = value
+	content.ContentEncoding = []byte(cfg.Encoding)
+
+	compressed := *req
+	compressed.Content = &content
+
+	return &compressed, nil
+}
+
+// Decompresses values with a registered content encoding in place, clearing
+// their encoding. Empty values, as returned for heads, are left as is.
+// Values may not decompress to more than limit bytes.
+func decompressContent(content []*RpbContent, limit int, ratio *compressionRatio) error {
+	for _, rc := range content {
+		if len(rc.ContentEncoding) == 0 || rc.GetDeleted() || len(rc.Value) == 0 {
+			continue
+		}
+
+		compressor := lookupCompressor(string(rc.ContentEncoding))
+		if compressor == nil {
+			continue
+		}
+
+		value, err := compressor.Decompress(rc.Value, limit)
+		if err != nil {
+			return err
+		}
+
+		ratio.add(len(rc.Value), len(value))
+		rc.Value = value
+		rc.ContentEncoding = nil
+	}
+
+	return nil
+}
+
+// Accumulates compressed and uncompressed sizes over an operation.
+type compressionRatio struct {
+	compressed   int
+	uncompressed int
+}
+
+func (r *compressionRatio) add(compressed int, uncompressed int) {
+	r.compressed += compressed
+	r.uncompressed += uncompressed
+}
+
+// Returns the compressed size over the uncompressed size, zero if nothing
+// was compressed.
+func (r *compressionRatio) value() float64 {
+	if r.uncompressed == 0 {
+		return 0
+	}
+
+	return float64(r.compressed) / float64(r.uncompressed)
+}
+
+// Reads a decompressed value, failing once it exceeds limit bytes.
+func readLimited(r io.Reader, limit int) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > limit {
+		return nil, ErrDecompressedTooLarge
+	}
+
+	return data, nil
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return readLimited(r, limit)
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > limit {
+		return nil, ErrDecompressedTooLarge
+	}
+
+	return snappy.Decode(nil, data)
+}
+
+// Shares a single encoder, which is safe for concurrent use through
+// EncodeAll. Decoders are created per value with its size limit.
+type zstdCompressor struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	err     error
+}
+
+func (z *zstdCompressor) init() error {
+	z.once.Do(func() {
+		z.encoder, z.err = zstd.NewWriter(nil)
+	})
+
+	return z.err
+}
+
+func (z *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+
+	return z.encoder.EncodeAll(data, nil), nil
+}
+
+func (z *zstdCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	d, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	value, err := readLimited(d, limit)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		err = ErrDecompressedTooLarge
+	}
+
+	return value, err
+}
@@ -0,0 +1,118 @@
+package riago
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	value := bytes.Repeat([]byte(`{"name":"bob","tags":["a","b","c"]}`), 100)
+
+	for _, encoding := range []string{"gzip", "snappy", "zstd"} {
+		store := newFakeStore()
+		client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+
+		var prof *Profile
+		client.SetInstrumenter(func(p *Profile) {
+			prof = p
+		})
+
+		assert.Nil(client.SetCompression("", "blobs", &Compression{Encoding: encoding, MinSize: 64}))
+
+		// Values are compressed on write without modifying the request
+		req := &RpbPutReq{Bucket: []byte("blobs"), Key: []byte("k"), Content: &RpbContent{Value: value}}
+		_, err := client.Put(req)
+		assert.Nil(err)
+		assert.Equal(value, req.Content.Value)
+		assert.Nil(req.Content.ContentEncoding)
+		assert.True(prof.CompressionRatio > 0 && prof.CompressionRatio < 0.5, encoding)
+
+		stored := store.get("blobs", "k")[0]
+		assert.Equal(encoding, string(stored.ContentEncoding))
+		assert.True(len(stored.Value) < len(value))
+
+		// And decompressed on read
+		resp, err := client.Get(&RpbGetReq{Bucket: []byte("blobs"), Key: []byte("k")})
+		assert.Nil(err)
+		assert.Equal(value, resp.Content[0].Value)
+		assert.Nil(resp.Content[0].ContentEncoding)
+		assert.Equal(float64(len(stored.Value))/float64(len(value)), prof.CompressionRatio)
+	}
+}
+
+func TestCompressionConfiguration(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+
+	assert.Equal(ErrUnknownEncoding, client.SetCompression("", "", &Compression{Encoding: "lz4"}))
+
+	value := bytes.Repeat([]byte("a"), 1000)
+	assert.Nil(client.SetCompression("", "", &Compression{Encoding: "gzip", MinSize: 100}))
+	assert.Nil(client.SetCompression("", "small", &Compression{Encoding: "snappy", MinSize: 10000}))
+
+	put := func(bucket string, key string, value []byte) *RpbContent {
+		_, err := client.Put(&RpbPutReq{Bucket: []byte(bucket), Key: []byte(key), Content: &RpbContent{Value: value}})
+		assert.Nil(err)
+		return store.get(bucket, key)[0]
+	}
+
+	// Type configuration applies to buckets without their own
+	assert.Equal("gzip", string(put("any", "a", value).ContentEncoding))
+
+	// Values below the threshold are stored as is
+	assert.Nil(put("any", "b", value[:99]).ContentEncoding)
+	assert.Nil(put("small", "a", value).ContentEncoding)
+
+	// Values that do not shrink are stored as is
+	assert.Nil(put("any", "c", []byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ!@#$%^&*()_+-=[]{};':,./<>?`~|0123456789")).ContentEncoding)
+
+	// Values written compressed by others are decompressed in any bucket
+	gz, _ := gzipCompressor{}.Compress([]byte("hello"))
+	store.seed("other", "k", &RpbContent{Value: gz, ContentEncoding: []byte("gzip")})
+	obj, err := client.FetchObject(&RpbGetReq{Bucket: []byte("other"), Key: []byte("k")})
+	assert.Nil(err)
+	assert.Equal("hello", string(obj.Content().Value))
+	assert.Equal("", obj.Content().ContentEncoding)
+
+	// Unknown encodings are left alone
+	store.seed("other", "k", &RpbContent{Value: []byte("x"), ContentEncoding: []byte("lz4")})
+	obj, err = client.FetchObject(&RpbGetReq{Bucket: []byte("other"), Key: []byte("k")})
+	assert.Nil(err)
+	assert.Equal("lz4", obj.Content().ContentEncoding)
+
+	// Corrupt values fail the read
+	store.seed("other", "k", &RpbContent{Value: []byte("x"), ContentEncoding: []byte("gzip")})
+	_, err = client.FetchObject(&RpbGetReq{Bucket: []byte("other"), Key: []byte("k")})
+	assert.NotNil(err)
+}
+
+func TestCompressionSizeLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+	client.SetMaxFrameSize(64 << 10)
+	assert.Nil(client.SetCompression("", "", &Compression{Encoding: "gzip"}))
+
+	// Values decompressing past the frame size are rejected
+	bomb := bytes.Repeat([]byte("a"), 1<<20)
+	for _, encoding := range []string{"gzip", "snappy", "zstd"} {
+		data, err := lookupCompressor(encoding).Compress(bomb)
+		assert.Nil(err)
+		assert.True(len(data) < 64<<10, encoding)
+
+		store.seed("bombs", encoding, &RpbContent{Value: data, ContentEncoding: []byte(encoding)})
+		_, err = client.Get(&RpbGetReq{Bucket: []byte("bombs"), Key: []byte(encoding)})
+		assert.Equal(ErrDecompressedTooLarge, err, encoding)
+
+		value, err := lookupCompressor(encoding).Decompress(data, len(bomb))
+		assert.Nil(err)
+		assert.Equal(bomb, value)
+	}
+}
@@ -1,29 +1,54 @@
 package riago
 
 import (
+	"context"
+	"encoding/binary"
 	"io"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 )
 
+// DefaultDialTimeout is the dial timeout, applied to custom dial functions
+// through the deadline of their context.
+var DefaultDialTimeout = 5 * time.Second
+
+// DialFunc establishes a network connection to the given address. It has the
+// same signature as net.Dialer.DialContext so custom dialers, proxies and
+// in-memory connections can be plugged in.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
 // Conn represents an individual connection to a Riak host.
 type Conn struct {
 	addr         string
-	conn         *net.TCPConn
+	dialer       DialFunc
+	conn         net.Conn
+	connMutex    sync.Mutex
 	ok           bool
+	written      bool
 	padlock      int32
 	mutex        sync.Mutex
 	readTimeout  time.Duration
 	writeTimeout time.Duration
+	maxFrameSize int
+	header       [4]byte
 }
 
 // Create a new Conn instance for the given address
 func NewConn(addr string) *Conn {
+	return NewConnWithDialer(addr, nil)
+}
+
+// Create a new Conn instance for the given address using a custom dial
+// function. A nil dial function uses a net.Dialer with DefaultDialTimeout.
+// Addresses prefixed with "unix:" are dialed as Unix domain sockets.
+func NewConnWithDialer(addr string, dial DialFunc) *Conn {
 	return &Conn{
-		addr: addr,
+		addr:   addr,
+		dialer: dial,
 	}
 }
 
@@ -45,7 +70,7 @@ func (c *Conn) Ping() (err error) {
 		return
 	}
 
-	err = c.response(nil)
+	err = c.response(MsgRpbPingResp, nil)
 
 	return
 }
@@ -61,22 +86,28 @@ func (c *Conn) Recover() error {
 
 // Attempts to connect to the Riak server. Must be called from within a lock.
 func (c *Conn) dial() (err error) {
-	var tcpAddr *net.TCPAddr
-
-	if tcpAddr, err = net.ResolveTCPAddr("tcp", c.addr); err != nil {
-		return
+	network, addr := "tcp", c.addr
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
 	}
 
-	if c.conn, err = net.DialTCP("tcp", nil, tcpAddr); err != nil {
-		return
+	dial := c.dialer
+	if dial == nil {
+		d := &net.Dialer{Timeout: DefaultDialTimeout, KeepAlive: 30 * time.Second}
+		dial = d.DialContext
 	}
 
-	if err != nil {
-		c.conn = nil
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDialTimeout)
+	defer cancel()
+
+	var conn net.Conn
+	if conn, err = dial(ctx, network, addr); err != nil {
 		return
 	}
 
-	c.conn.SetKeepAlive(true)
+	c.connMutex.Lock()
+	c.conn = conn
+	c.connMutex.Unlock()
 
 	c.ok = true
 
@@ -87,26 +118,49 @@ func (c *Conn) dial() (err error) {
 // the connection as down. Must be called from within a lock.
 func (c *Conn) close() (err error) {
 	c.ok = false
+
+	c.connMutex.Lock()
 	if c.conn != nil {
 		err = c.conn.Close()
 		c.conn = nil
 	}
+	c.connMutex.Unlock()
 
 	return
 }
 
+// Interrupts any in-flight request by closing the socket. Safe to call from
+// outside the lock; the lock holder sees an error and fails the connection.
+func (c *Conn) interrupt() {
+	c.connMutex.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.connMutex.Unlock()
+}
+
 // Encode and write a request to the Riak server. Must be called from
 // within a lock.
 func (c *Conn) request(code byte, req proto.Message) (err error) {
 	var buf []byte
 
+	c.written = false
+
 	if c.conn == nil || !c.ok {
 		if err = c.dial(); err != nil {
 			return
 		}
 	}
 
-	if buf, err = encode(code, req); err != nil {
+	b := getBuffer()
+	defer putBuffer(b)
+
+	if buf, err = encode(b, code, req); err != nil {
+		return
+	}
+
+	if len(buf)-4 > c.frameLimit() {
+		err = ErrFrameTooLarge
 		return
 	}
 
@@ -115,16 +169,19 @@ func (c *Conn) request(code byte, req proto.Message) (err error) {
 	return
 }
 
-// Read and decode a response from the Riak server. Must be called from
-// within a lock.
-func (c *Conn) response(resp proto.Message) (err error) {
+// Read and decode a response from the Riak server, verifying the response
+// code unless expect is zero. Must be called from within a lock.
+func (c *Conn) response(expect byte, resp proto.Message) (err error) {
 	var buf []byte
 
-	if buf, err = c.read(); err != nil {
+	b := getBuffer()
+	defer putBuffer(b)
+
+	if buf, err = c.read(b); err != nil {
 		return
 	}
 
-	if err = decode(buf, resp); err != nil {
+	if err = decode(buf, expect, resp); err != nil {
 		return
 	}
 
@@ -138,27 +195,45 @@ func (c *Conn) write(buf []byte) (err error) {
 		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
 	}
 
-	_, err = c.conn.Write(buf)
+	var n int
+	n, err = c.conn.Write(buf)
+	c.written = n > 0 || err == nil
+
 	return
 }
 
-// Read a length-prefixed buffer from the connection, establishing a deadline
-// if a timeout is set.
-func (c *Conn) read() (buf []byte, err error) {
-	var sizebuf []byte
-	var size int
+// Read a length-prefixed buffer from the connection into the given buffer,
+// establishing a deadline if a timeout is set. The returned slice is only
+// valid until the buffer is reused.
+func (c *Conn) read(b *proto.Buffer) (buf []byte, err error) {
+	var size uint32
 
 	if c.readTimeout > 0 {
 		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
 	}
 
-	sizebuf = make([]byte, 4)
-	if _, err = io.ReadFull(c.conn, sizebuf); err != nil {
+	if _, err = io.ReadFull(c.conn, c.header[:]); err != nil {
 		return
 	}
 
-	size = int(sizebuf[0])<<24 + int(sizebuf[1])<<16 + int(sizebuf[2])<<8 + int(sizebuf[3])
-	buf = make([]byte, size)
+	size = binary.BigEndian.Uint32(c.header[:])
+
+	if size == 0 {
+		err = ErrEmptyFrame
+		return
+	}
+
+	// Compared before converting so sizes do not overflow on 32-bit targets.
+	if int64(size) > int64(c.frameLimit()) {
+		err = ErrFrameTooLarge
+		return
+	}
+
+	if buf = b.Bytes(); cap(buf) < int(size) {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	b.SetBuf(buf)
 
 	if _, err = io.ReadFull(c.conn, buf); err != nil {
 		return
@@ -167,6 +242,15 @@ func (c *Conn) read() (buf []byte, err error) {
 	return
 }
 
+// Returns the maximum frame size for this connection.
+func (c *Conn) frameLimit() int {
+	if c.maxFrameSize > 0 {
+		return c.maxFrameSize
+	}
+
+	return DefaultMaxFrameSize
+}
+
 // Obtain a big lock on everything scary
 func (c *Conn) lock() {
 	c.mutex.Lock()
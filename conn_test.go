@@ -0,0 +1,205 @@
+package riago
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// Handles a single request on a fake Riak connection. The handler may call
+// reply any number of times to write encoded response messages.
+type fakeHandler func(addr string, code byte, body []byte, reply func(code byte, body []byte))
+
+// Replies to every request with an empty response of the next message code.
+func fakeEcho(addr string, code byte, body []byte, reply func(byte, []byte)) {
+	reply(code+1, nil)
+}
+
+// Marshals a message for a fake reply.
+func mustMarshal(msg proto.Message) []byte {
+	buf, err := proto.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+
+	return buf
+}
+
+// Dials in-memory connections served by a fake Riak handler.
+func fakeDialer(handle fakeHandler) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go serveFake(server, addr, handle)
+		return client, nil
+	}
+}
+
+// Listens on a local TCP port and serves connections with a fake Riak
+// handler. Returns the address and a function to stop listening.
+func fakeListener(handle fakeHandler) (addr string, stop func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveFake(conn, l.Addr().String(), handle)
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+// Serves length-prefixed requests on a connection until it is closed.
+// Buffers are reused so the server adds no allocations per request.
+func serveFake(conn net.Conn, addr string, handle fakeHandler) {
+	defer conn.Close()
+
+	var out []byte
+	reply := func(code byte, body []byte) {
+		out = append(out[:0], 0, 0, 0, 0, code)
+		out = append(out, body...)
+		binary.BigEndian.PutUint32(out, uint32(len(body)+1))
+
+		conn.Write(out)
+	}
+
+	size := make([]byte, 4)
+	var buf []byte
+	for {
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return
+		}
+
+		n := int(binary.BigEndian.Uint32(size))
+		if cap(buf) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+
+		handle(addr, buf[0], buf[1:], reply)
+	}
+}
+
+func TestConnCustomDialer(t *testing.T) {
+	assert := assert.New(t)
+
+	dials := 0
+	dial := fakeDialer(fakeEcho)
+	conn := NewConnWithDialer("riak", func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials += 1
+		return dial(ctx, network, addr)
+	})
+
+	err := conn.Recover()
+	assert.Nil(err)
+	assert.Equal(1, dials)
+
+	err = conn.Ping()
+	assert.Nil(err)
+
+	err = conn.Close()
+	assert.Nil(err)
+}
+
+func TestConnDialUnixSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	var network, addr string
+	dial := func(ctx context.Context, n, a string) (net.Conn, error) {
+		network, addr = n, a
+		client, _ := net.Pipe()
+		return client, nil
+	}
+
+	conn := NewConnWithDialer("unix:/tmp/riak.sock", dial)
+	err := conn.Recover()
+	assert.Nil(err)
+	assert.Equal("unix", network)
+	assert.Equal("/tmp/riak.sock", addr)
+
+	conn.Close()
+}
+
+// A connection that reads from a fixed buffer.
+type bufConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (b *bufConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func TestConnReadFrameLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	// Zero-length frames are rejected
+	conn := &Conn{conn: &bufConn{r: bytes.NewReader([]byte{0, 0, 0, 0})}}
+	_, err := conn.read(proto.NewBuffer(nil))
+	assert.Equal(ErrEmptyFrame, err)
+
+	// Frames over the limit are rejected before allocating
+	conn = &Conn{conn: &bufConn{r: bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff})}}
+	_, err = conn.read(proto.NewBuffer(nil))
+	assert.Equal(ErrFrameTooLarge, err)
+
+	// Including sizes that are negative as a 32-bit int
+	conn = &Conn{conn: &bufConn{r: bytes.NewReader([]byte{0x80, 0, 0, 0})}}
+	_, err = conn.read(proto.NewBuffer(nil))
+	assert.Equal(ErrFrameTooLarge, err)
+
+	conn = &Conn{conn: &bufConn{r: bytes.NewReader([]byte{0, 0, 0, 3, 10, 0, 0})}, maxFrameSize: 2}
+	_, err = conn.read(proto.NewBuffer(nil))
+	assert.Equal(ErrFrameTooLarge, err)
+
+	// Frames within the limit are read
+	conn = &Conn{conn: &bufConn{r: bytes.NewReader([]byte{0, 0, 0, 1, MsgRpbPingResp})}, maxFrameSize: 1}
+	buf, err := conn.read(proto.NewBuffer(nil))
+	assert.Nil(err)
+	assert.Equal([]byte{MsgRpbPingResp}, buf)
+
+	// Requests over the limit are not sent
+	conn = &Conn{conn: &bufConn{}, ok: true, maxFrameSize: 4}
+	err = conn.request(MsgRpbGetReq, &RpbGetReq{Bucket: []byte("bucket"), Key: []byte("key")})
+	assert.Equal(ErrFrameTooLarge, err)
+	assert.False(conn.written)
+}
+
+func FuzzConnRead(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 1, MsgRpbPingResp})
+	f.Add([]byte{0, 0, 0, 3, MsgRpbGetResp, 0x12, 0x00, 0, 0, 0, 1, MsgRpbDelResp})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{0x80, 0, 0, 0})
+	f.Add([]byte{0, 0, 0, 0})
+	f.Add([]byte{'H', 'T', 'T', 'P', '/', '1', '.', '1'})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		conn := &Conn{conn: &bufConn{r: bytes.NewReader(data)}, maxFrameSize: 1024}
+
+		for {
+			buf, err := conn.read(proto.NewBuffer(nil))
+			if err != nil {
+				return
+			}
+			if len(buf) == 0 || len(buf) > 1024 {
+				t.Fatalf("read frame of invalid size %d", len(buf))
+			}
+			decode(buf, 0, &RpbGetResp{})
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package riago
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// SetFilterDeleted removes tombstone siblings from the responses of Get, and
+// so from the objects returned by FetchObject. An object whose siblings are
+// all tombstones then reads as not found while keeping its vclock.
+//
+// The setting is global to the client: it applies to every Get in every
+// bucket, including those made by Update, GetMany, WalkLinks and
+// ChunkedStore. Use a separate client to read tombstones while filtering is
+// enabled.
+func (c *Client) SetFilterDeleted(enabled bool) {
+	c.filterDeleted = enabled
+}
+
+// Deletes an object using a Riak Del request sent with its current vclock, so
+// the delete supersedes every sibling rather than resurrecting or adding to
+// them. Unless the request has a vclock, it is fetched first along with that
+// of any tombstone. Objects that do not exist are not deleted.
+func (c *Client) DeleteObject(req *RpbDelReq) (err error) {
+	var resp *RpbGetResp
+
+	del := *req
+
+	if len(del.Vclock) == 0 {
+		resp, err = c.Get(&RpbGetReq{
+			Type:          req.Type,
+			Bucket:        req.Bucket,
+			Key:           req.Key,
+			Head:          proto.Bool(true),
+			Deletedvclock: proto.Bool(true),
+		})
+		if err != nil {
+			return
+		}
+
+		if len(resp.GetVclock()) == 0 {
+			return
+		}
+
+		del.Vclock = resp.GetVclock()
+	}
+
+	return c.Del(&del)
+}
+
+// Returns the content without tombstones.
+func withoutTombstones(content []*RpbContent) (live []*RpbContent) {
+	for _, rc := range content {
+		if !rc.GetDeleted() {
+			live = append(live, rc)
+		}
+	}
+
+	return
+}
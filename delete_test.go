@@ -0,0 +1,85 @@
+package riago
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientFilterDeleted(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+
+	vclock := store.seed("users", "bob",
+		&RpbContent{Value: []byte("v1")},
+		&RpbContent{Value: []byte{}, Deleted: proto.Bool(true)},
+	)
+	req := &RpbGetReq{Bucket: []byte("users"), Key: []byte("bob")}
+
+	// Tombstone siblings are returned by default
+	resp, err := client.Get(req)
+	assert.Nil(err)
+	assert.Len(resp.Content, 2)
+
+	client.SetFilterDeleted(true)
+
+	resp, err = client.Get(req)
+	assert.Nil(err)
+	assert.Len(resp.Content, 1)
+	assert.Equal("v1", string(resp.Content[0].Value))
+	assert.Equal(vclock, resp.Vclock)
+
+	obj, err := client.FetchObject(req)
+	assert.Nil(err)
+	assert.False(obj.HasSiblings())
+	assert.Equal("v1", string(obj.Content().Value))
+
+	// Objects with only tombstones read as not found but keep their vclock
+	vclock = store.seed("users", "carol",
+		&RpbContent{Value: []byte{}, Deleted: proto.Bool(true)},
+		&RpbContent{Value: []byte{}, Deleted: proto.Bool(true)},
+	)
+	resp, err = client.Get(&RpbGetReq{Bucket: []byte("users"), Key: []byte("carol"), Deletedvclock: proto.Bool(true)})
+	assert.Nil(err)
+	assert.Empty(resp.Content)
+	assert.Equal(vclock, resp.Vclock)
+}
+
+func TestClientDeleteObject(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+
+	// Deletes send the vclock covering every sibling, including tombstones
+	vclock := store.seed("users", "bob",
+		&RpbContent{Value: []byte("v1")},
+		&RpbContent{Value: []byte{}, Deleted: proto.Bool(true)},
+	)
+	assert.Nil(client.DeleteObject(&RpbDelReq{Bucket: []byte("users"), Key: []byte("bob"), W: proto.Uint32(2)}))
+	assert.Len(store.dels, 1)
+	assert.Equal(vclock, store.dels[0].Vclock)
+	assert.Equal(uint32(2), store.dels[0].GetW())
+	assert.Empty(store.get("users", "bob"))
+
+	// Tombstones alone are deleted with their vclock
+	vclock = store.seed("users", "carol", &RpbContent{Value: []byte{}, Deleted: proto.Bool(true)})
+	req := &RpbDelReq{Bucket: []byte("users"), Key: []byte("carol")}
+	assert.Nil(client.DeleteObject(req))
+	assert.Len(store.dels, 2)
+	assert.Equal(vclock, store.dels[1].Vclock)
+	assert.Nil(req.Vclock)
+
+	// A vclock given with the request is used as is
+	store.seed("users", "dave", &RpbContent{Value: []byte("v1")})
+	assert.Nil(client.DeleteObject(&RpbDelReq{Bucket: []byte("users"), Key: []byte("dave"), Vclock: []byte("mine")}))
+	assert.Len(store.dels, 3)
+	assert.Equal("mine", string(store.dels[2].Vclock))
+
+	// Missing objects are not deleted
+	assert.Nil(client.DeleteObject(&RpbDelReq{Bucket: []byte("users"), Key: []byte("erin")}))
+	assert.Len(store.dels, 3)
+}
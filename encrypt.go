@@ -0,0 +1,350 @@
+package riago
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// EncryptionAlgorithm is the algorithm recorded in the user metadata of
+// encrypted values.
+const EncryptionAlgorithm = "AES-256-GCM"
+
+// User metadata keys describing how a value was encrypted.
+const (
+	UsermetaEncryptionAlgorithm = "x-riago-enc-alg"
+	UsermetaEncryptionKeyID     = "x-riago-enc-key-id"
+	UsermetaEncryptionDataKey   = "x-riago-enc-data-key"
+)
+
+var (
+	ErrUnknownKey           = errors.New("unknown encryption key")
+	ErrUnsupportedAlgorithm = errors.New("unsupported encryption algorithm")
+	ErrInvalidCiphertext    = errors.New("invalid ciphertext")
+	ErrNoKeyProvider        = errors.New("encryption requires a key provider")
+	ErrEncryptionKeyless    = errors.New("encrypted values must be stored with a key")
+	ErrUnencryptedValue     = errors.New("value is not encrypted")
+)
+
+// KeyProvider wraps and unwraps the data keys encrypting object values with
+// key-encryption keys identified by ID, typically held by a KMS.
+type KeyProvider interface {
+	// CurrentKeyID returns the ID of the key wrapping new data keys.
+	CurrentKeyID() string
+	WrapKey(keyID string, dataKey []byte) ([]byte, error)
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Encryption configures the envelope encryption of values stored in a bucket.
+type Encryption struct {
+	Provider       KeyProvider
+	RotateOnRead   bool // Re-encrypt values read under a key other than the current one, or unencrypted
+	AllowPlaintext bool // Return values stored without encryption instead of ErrUnencryptedValue
+}
+
+// StaticKeyProvider wraps data keys with AES-GCM under fixed 256-bit keys.
+type StaticKeyProvider struct {
+	Current string            // ID of the key wrapping new data keys
+	Keys    map[string][]byte // Keys by ID, including retired ones
+}
+
+func (p *StaticKeyProvider) CurrentKeyID() string {
+	return p.Current
+}
+
+func (p *StaticKeyProvider) WrapKey(keyID string, dataKey []byte) ([]byte, error) {
+	key, ok := p.Keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return sealGCM(key, dataKey, []byte(keyID))
+}
+
+func (p *StaticKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.Keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return openGCM(key, wrapped, []byte(keyID))
+}
+
+// SetEncryption encrypts values stored with Put in the given bucket type and
+// bucket with AES-GCM under a random data key per value, bound to the bucket
+// type, bucket and key of the object so it does not decrypt elsewhere. Values
+// must therefore be stored with a key. The data key is wrapped by the
+// configured key provider and recorded with the key ID and algorithm in user
+// metadata. Values read with Get are decrypted; values stored without
+// encryption fail the read with ErrUnencryptedValue unless plaintext is
+// allowed, as while migrating a bucket. If enabled, values encrypted under a
+// key other than the current one, or allowed unencrypted, are encrypted under
+// the current key and written back (best effort, only if not modified since).
+// An empty bucket
+// applies to every bucket of the type without its own configuration and a nil
+// configuration removes it.
+func (c *Client) SetEncryption(typ string, bucket string, cfg *Encryption) (err error) {
+	if cfg != nil && cfg.Provider == nil {
+		return ErrNoKeyProvider
+	}
+
+	if c.encryption == nil {
+		c.encryption = make(map[string]*Encryption)
+	}
+
+	if cfg == nil {
+		delete(c.encryption, typ+"/"+bucket)
+	} else {
+		c.encryption[typ+"/"+bucket] = cfg
+	}
+
+	return
+}
+
+// Returns the encryption configured for a bucket type and bucket, if any.
+func (c *Client) encryptionFor(typ string, bucket string) *Encryption {
+	if cfg, ok := c.encryption[typ+"/"+bucket]; ok {
+		return cfg
+	}
+
+	return c.encryption[typ+"/"]
+}
+
+// Encrypts put requests and decrypts the values of responses. Runs inside
+// compression so values are compressed before they are encrypted.
+func (c *Client) encrypt(call *Call, next Invoker) (err error) {
+	var cfg *Encryption
+	var aad []byte
+
+	switch req := call.Req.(type) {
+	case *RpbPutReq:
+		if cfg = c.encryptionFor(string(req.GetType()), string(req.GetBucket())); cfg != nil && req.Content != nil {
+			if len(req.Key) == 0 {
+				return ErrEncryptionKeyless
+			}
+
+			aad = locationAAD(req.Type, req.Bucket, req.Key)
+
+			encrypted := *req
+			if encrypted.Content, err = encryptContent(cfg.Provider, req.Content, aad); err != nil {
+				return
+			}
+
+			call.Req = &encrypted
+			defer func() { call.Req = req }()
+		}
+
+	case *RpbGetReq:
+		cfg = c.encryptionFor(string(req.GetType()), string(req.GetBucket()))
+		aad = locationAAD(req.Type, req.Bucket, req.Key)
+	}
+
+	if err = next(call); err != nil || cfg == nil {
+		return
+	}
+
+	switch resp := call.Resp.(type) {
+	case *RpbGetResp:
+		var stale bool
+		if stale, err = decryptContent(cfg, resp.Content, aad); err != nil {
+			return
+		}
+
+		// Followers of a coalesced read leave rotation to the leader.
+		if stale && cfg.RotateOnRead && !call.Profile.Coalesced && len(resp.Content) == 1 {
+			c.rotate(call.Req.(*RpbGetReq), resp)
+		}
+
+	case *RpbPutResp:
+		_, err = decryptContent(cfg, resp.Content, aad)
+	}
+
+	return
+}
+
+// Writes a decrypted value back so it is encrypted under the current key,
+// unless the object was modified since it was read. On success the response
+// is given the new vclock.
+func (c *Client) rotate(req *RpbGetReq, resp *RpbGetResp) {
+	put, err := c.Put(&RpbPutReq{
+		Type:          req.Type,
+		Bucket:        req.Bucket,
+		Key:           req.Key,
+		Vclock:        resp.Vclock,
+		Content:       newContent(resp.Content[0]).proto(),
+		IfNotModified: proto.Bool(true),
+		ReturnHead:    proto.Bool(true),
+	})
+
+	if err == nil && len(put.GetVclock()) > 0 {
+		resp.Vclock = put.GetVclock()
+	}
+}
+
+// Returns the additional data binding an encrypted value to the bucket type,
+// bucket and key of its object, each prefixed by its length.
+func locationAAD(typ []byte, bucket []byte, key []byte) (aad []byte) {
+	var n [binary.MaxVarintLen64]byte
+
+	if len(typ) == 0 {
+		typ = []byte("default")
+	}
+
+	for _, part := range [][]byte{typ, bucket, key} {
+		aad = append(aad, n[:binary.PutUvarint(n[:], uint64(len(part)))]...)
+		aad = append(aad, part...)
+	}
+
+	return
+}
+
+// Returns a copy of the content with its value encrypted under a new data
+// key wrapped by the current key of the provider, authenticating the given
+// additional data.
+func encryptContent(p KeyProvider, rc *RpbContent, aad []byte) (encrypted *RpbContent, err error) {
+	var value, wrapped []byte
+
+	dataKey := make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, dataKey); err != nil {
+		return
+	}
+
+	if value, err = sealGCM(dataKey, rc.Value, aad); err != nil {
+		return
+	}
+
+	keyID := p.CurrentKeyID()
+	if wrapped, err = p.WrapKey(keyID, dataKey); err != nil {
+		return
+	}
+
+	content := *rc
+	content.Value = value
+	content.Usermeta = append(withoutEncryptionMeta(rc.Usermeta),
+		&RpbPair{Key: []byte(UsermetaEncryptionAlgorithm), Value: []byte(EncryptionAlgorithm)},
+		&RpbPair{Key: []byte(UsermetaEncryptionKeyID), Value: []byte(keyID)},
+		&RpbPair{Key: []byte(UsermetaEncryptionDataKey), Value: []byte(base64.StdEncoding.EncodeToString(wrapped))},
+	)
+
+	return &content, nil
+}
+
+// Decrypts encrypted values in place, removing the encryption metadata.
+// Reports whether any value was encrypted under a key other than the current
+// one or allowed unencrypted.
+func decryptContent(cfg *Encryption, content []*RpbContent, aad []byte) (stale bool, err error) {
+	p := cfg.Provider
+
+	for _, rc := range content {
+		var alg, keyID, encodedKey string
+
+		for _, pair := range rc.Usermeta {
+			switch string(pair.Key) {
+			case UsermetaEncryptionAlgorithm:
+				alg = string(pair.Value)
+			case UsermetaEncryptionKeyID:
+				keyID = string(pair.Value)
+			case UsermetaEncryptionDataKey:
+				encodedKey = string(pair.Value)
+			}
+		}
+
+		// Heads returned by Put carry the metadata without the value.
+		if rc.GetDeleted() || len(rc.Value) == 0 {
+			continue
+		}
+
+		if alg == "" {
+			if !cfg.AllowPlaintext {
+				err = ErrUnencryptedValue
+				return
+			}
+
+			stale = true
+			continue
+		}
+
+		if alg != EncryptionAlgorithm {
+			err = ErrUnsupportedAlgorithm
+			return
+		}
+
+		var wrapped, dataKey, value []byte
+		if wrapped, err = base64.StdEncoding.DecodeString(encodedKey); err != nil {
+			return
+		}
+
+		if dataKey, err = p.UnwrapKey(keyID, wrapped); err != nil {
+			return
+		}
+
+		if value, err = openGCM(dataKey, rc.Value, aad); err != nil {
+			return
+		}
+
+		rc.Value = value
+		rc.Usermeta = withoutEncryptionMeta(rc.Usermeta)
+		stale = stale || keyID != p.CurrentKeyID()
+	}
+
+	return
+}
+
+// Returns a copy of user metadata without the encryption entries.
+func withoutEncryptionMeta(usermeta []*RpbPair) (pairs []*RpbPair) {
+	for _, pair := range usermeta {
+		switch string(pair.Key) {
+		case UsermetaEncryptionAlgorithm, UsermetaEncryptionKeyID, UsermetaEncryptionDataKey:
+		default:
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return
+}
+
+// Encrypts data with AES-GCM, prefixing the random nonce and authenticating
+// the additional data.
+func sealGCM(key []byte, data []byte, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(data)+gcm.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, data, aad), nil
+}
+
+// Decrypts data encrypted by sealGCM with the same additional data.
+func openGCM(key []byte, data []byte, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+}
@@ -0,0 +1,148 @@
+package riago
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns the value of a user metadata pair, if present.
+func usermeta(rc *RpbContent, key string) string {
+	for _, p := range rc.Usermeta {
+		if string(p.Key) == key {
+			return string(p.Value)
+		}
+	}
+
+	return ""
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+
+	provider := &StaticKeyProvider{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	assert.Equal(ErrNoKeyProvider, client.SetEncryption("", "pii", &Encryption{}))
+	assert.Nil(client.SetEncryption("", "pii", &Encryption{Provider: provider}))
+
+	obj := NewObject("pii", "bob")
+	obj.Content().Value = []byte("555-0100")
+	obj.Content().SetUsermeta("owner", "alice")
+	assert.Nil(client.StoreObject(obj))
+
+	// Values are stored encrypted with the key ID and algorithm
+	stored := store.get("pii", "bob")[0]
+	assert.NotContains(string(stored.Value), "555-0100")
+	assert.Equal(EncryptionAlgorithm, usermeta(stored, UsermetaEncryptionAlgorithm))
+	assert.Equal("k1", usermeta(stored, UsermetaEncryptionKeyID))
+	assert.NotEmpty(usermeta(stored, UsermetaEncryptionDataKey))
+	assert.Equal("alice", usermeta(stored, "owner"))
+
+	// And decrypted on read
+	obj, err := client.FetchObject(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("bob")})
+	assert.Nil(err)
+	assert.Equal("555-0100", string(obj.Content().Value))
+	assert.Equal(map[string]string{"owner": "alice"}, obj.Content().Usermeta)
+
+	// Data keys are unique per value
+	assert.Nil(client.StoreObject(obj))
+	assert.NotEqual(usermeta(stored, UsermetaEncryptionDataKey), usermeta(store.get("pii", "bob")[0], UsermetaEncryptionDataKey))
+
+	// Values copied to another object fail the read
+	store.seed("pii", "carol", store.get("pii", "bob")...)
+	_, err = client.FetchObject(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("carol")})
+	assert.NotNil(err)
+
+	// Values must be stored with a key to be bound to it
+	_, err = client.Put(&RpbPutReq{Bucket: []byte("pii"), Content: &RpbContent{Value: []byte("555-0199")}})
+	assert.Equal(ErrEncryptionKeyless, err)
+
+	// Unknown keys and tampered values fail the read
+	provider.Keys = map[string][]byte{}
+	_, err = client.FetchObject(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("bob")})
+	assert.Equal(ErrUnknownKey, err)
+
+	provider.Keys = map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}
+	store.get("pii", "bob")[0].Value[20] ^= 0xff
+	_, err = client.FetchObject(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("bob")})
+	assert.NotNil(err)
+
+	// Values stored without encryption fail the read unless allowed
+	store.seed("pii", "dave", &RpbContent{Value: []byte("555-0123")})
+	_, err = client.FetchObject(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("dave")})
+	assert.Equal(ErrUnencryptedValue, err)
+
+	assert.Nil(client.SetEncryption("", "pii", &Encryption{Provider: provider, AllowPlaintext: true}))
+	obj, err = client.FetchObject(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("dave")})
+	assert.Nil(err)
+	assert.Equal("555-0123", string(obj.Content().Value))
+	assert.Equal("555-0123", string(store.get("pii", "dave")[0].Value))
+}
+
+func TestEncryptionRotateOnRead(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+
+	provider := &StaticKeyProvider{Current: "k1", Keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}}
+	assert.Nil(client.SetEncryption("", "", &Encryption{Provider: provider, RotateOnRead: true}))
+	assert.Nil(client.SetCompression("", "", &Compression{Encoding: "gzip"}))
+
+	value := bytes.Repeat([]byte("secret "), 100)
+	_, err := client.Put(&RpbPutReq{Bucket: []byte("pii"), Key: []byte("bob"), Content: &RpbContent{Value: value}})
+	assert.Nil(err)
+
+	// Values are compressed before they are encrypted
+	stored := store.get("pii", "bob")[0]
+	assert.Equal("gzip", string(stored.ContentEncoding))
+	assert.True(len(stored.Value) < len(value))
+
+	// Values under the current key are left alone
+	resp, err := client.Get(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("bob")})
+	assert.Nil(err)
+	assert.Equal(value, resp.Content[0].Value)
+	assert.Equal(stored, store.get("pii", "bob")[0])
+
+	// Reads re-encrypt values under a retired key
+	provider.Current = "k2"
+	resp, err = client.Get(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("bob")})
+	assert.Nil(err)
+	assert.Equal(value, resp.Content[0].Value)
+
+	rotated := store.get("pii", "bob")
+	assert.Len(rotated, 1)
+	assert.Equal("k2", usermeta(rotated[0], UsermetaEncryptionKeyID))
+	assert.Equal("gzip", string(rotated[0].ContentEncoding))
+
+	// The response carries the vclock of the rotated value
+	_, err = client.Put(&RpbPutReq{Bucket: []byte("pii"), Key: []byte("bob"), Vclock: resp.Vclock, Content: &RpbContent{Value: []byte("new")}})
+	assert.Nil(err)
+	assert.Len(store.get("pii", "bob"), 1)
+
+	delete(provider.Keys, "k1")
+	resp, err = client.Get(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("bob")})
+	assert.Nil(err)
+	assert.Equal("new", string(resp.Content[0].Value))
+
+	// Reads encrypt values allowed unencrypted
+	assert.Nil(client.SetEncryption("", "", &Encryption{Provider: provider, RotateOnRead: true, AllowPlaintext: true}))
+	store.seed("pii", "carol", &RpbContent{Value: []byte("legacy")})
+	resp, err = client.Get(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("carol")})
+	assert.Nil(err)
+	assert.Equal("legacy", string(resp.Content[0].Value))
+
+	encrypted := store.get("pii", "carol")[0]
+	assert.NotContains(string(encrypted.Value), "legacy")
+	assert.Equal("k2", usermeta(encrypted, UsermetaEncryptionKeyID))
+
+	resp, err = client.Get(&RpbGetReq{Bucket: []byte("pii"), Key: []byte("carol")})
+	assert.Nil(err)
+	assert.Equal("legacy", string(resp.Content[0].Value))
+}
@@ -0,0 +1,146 @@
+package riago
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var errHedgeCancelled = errors.New("hedged request cancelled")
+
+// A single branch of a hedged request, with its own connection, response
+// and profile.
+type hedgeBranch struct {
+	conn   *Conn
+	resp   proto.Message
+	prof   *Profile
+	err    error
+	hedge  bool
+	cancel chan struct{}
+}
+
+// Performs a single request with a single response, issuing an identical
+// request on another connection if the first has not completed within the
+// hedge delay. The first successful response wins and the losing request is
+// cancelled by closing its connection.
+func (c *Client) hedge(call *Call) (err error) {
+	if c.hedgeDelay <= 0 || c.pipelines != nil {
+		return c.do(call)
+	}
+
+	var conn *Conn
+
+	resp, prof := call.Resp, call.Profile
+
+	t := time.Now()
+	if conn, err = c.pool.Get(); err != nil {
+		return
+	}
+	prof.ConnWait = time.Now().Sub(t)
+
+	results := make(chan *hedgeBranch, 2)
+	branches := []*hedgeBranch{c.branch(conn, call, false, results)}
+
+	timer := time.NewTimer(c.hedgeDelay)
+	defer timer.Stop()
+
+	var winner *hedgeBranch
+
+loop:
+	for received := 0; received < len(branches); {
+		select {
+		case <-timer.C:
+			if other := c.pool.getIdle(conn.addr); other != nil {
+				prof.Hedges += 1
+				branches = append(branches, c.branch(other, call, true, results))
+			}
+
+		case b := <-results:
+			received += 1
+			if winner == nil || winner.err != nil {
+				winner = b
+			}
+			if b.err == nil {
+				break loop
+			}
+		}
+	}
+
+	// Cancel any branch still in flight.
+	for _, b := range branches {
+		if b != winner {
+			close(b.cancel)
+		}
+	}
+
+	if winner.hedge && winner.err == nil {
+		prof.HedgeWins += 1
+	}
+
+	call.Conn = winner.conn
+
+	prof.ConnLock = winner.prof.ConnLock
+	prof.Request = winner.prof.Request
+	prof.Response = winner.prof.Response
+	prof.written = winner.prof.written
+
+	if winner.err == nil && resp != nil {
+		resp.Reset()
+		proto.Merge(resp, winner.resp)
+	}
+
+	return winner.err
+}
+
+// Starts a branch of a hedged request on the given connection, reporting
+// the branch on the results channel when it completes.
+func (c *Client) branch(conn *Conn, call *Call, hedge bool, results chan<- *hedgeBranch) (b *hedgeBranch) {
+	b = &hedgeBranch{
+		conn:   conn,
+		prof:   NewProfile(call.Profile.Name, call.Profile.Object),
+		hedge:  hedge,
+		cancel: make(chan struct{}),
+	}
+
+	if call.Resp != nil {
+		b.resp = proto.Clone(call.Resp)
+		b.resp.Reset()
+	}
+
+	go func() {
+		b.err = c.use(conn, func(conn *Conn) error {
+			return c.branchExchange(b, conn, call)
+		}, b.prof)
+		results <- b
+	}()
+
+	return
+}
+
+// Performs the request and response for a branch, interrupting the
+// connection if the branch is cancelled while in flight. A cancelled branch
+// always returns an error so its connection is failed rather than reused.
+func (c *Client) branchExchange(b *hedgeBranch, conn *Conn, call *Call) (err error) {
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+
+	go func() {
+		select {
+		case <-b.cancel:
+			conn.interrupt()
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+
+	err = c.exchange(conn, call.Code, call.Req, call.RespCode, b.resp, b.prof)
+
+	close(stop)
+	if <-interrupted {
+		err = errHedgeCancelled
+	}
+
+	return
+}
@@ -0,0 +1,67 @@
+package riago
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves gets from a slow node and a fast node.
+func hedgeHandler(addr string, code byte, body []byte, reply func(byte, []byte)) {
+	if code != MsgRpbGetReq {
+		reply(code+1, nil)
+		return
+	}
+
+	if addr == "slow:8087" {
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	reply(MsgRpbGetResp, mustMarshal(&RpbGetResp{Vclock: []byte(addr)}))
+}
+
+func TestHedgedGet(t *testing.T) {
+	assert := assert.New(t)
+
+	pool := NewClusterPool([]string{"slow:8087", "fast:8087"}, 2, fakeDialer(hedgeHandler))
+	client := NewClientWithPool(pool)
+	client.SetHedgeDelay(10 * time.Millisecond)
+
+	var prof *Profile
+	client.SetInstrumenter(func(p *Profile) {
+		prof = p
+	})
+
+	t0 := time.Now()
+	resp, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("k")})
+	assert.Nil(err)
+	assert.Equal("fast:8087", string(resp.GetVclock()))
+	assert.True(time.Now().Sub(t0) < 250*time.Millisecond)
+	assert.Equal(int32(1), prof.Hedges)
+	assert.Equal(int32(1), prof.HedgeWins)
+
+	// The losing connection is cancelled and redialed
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(int64(3), client.Stats().Dials)
+}
+
+func TestHedgedGetFastPrimary(t *testing.T) {
+	assert := assert.New(t)
+
+	pool := NewClusterPool([]string{"fast:8087", "slow:8087"}, 2, fakeDialer(hedgeHandler))
+	client := NewClientWithPool(pool)
+	client.SetHedgeDelay(100 * time.Millisecond)
+
+	var prof *Profile
+	client.SetInstrumenter(func(p *Profile) {
+		prof = p
+	})
+
+	resp, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("k")})
+	assert.Nil(err)
+	assert.Equal("fast:8087", string(resp.GetVclock()))
+	assert.Equal(int32(0), prof.Hedges)
+	assert.Equal(int32(0), prof.HedgeWins)
+	assert.Equal(int64(2), client.Stats().Dials)
+}
@@ -0,0 +1,216 @@
+package riago
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var (
+	ErrNoLinkSteps       = errors.New("link walk requires at least one step")
+	ErrInvalidLinkResult = errors.New("invalid link phase result")
+)
+
+// LinkStep selects the links followed in one step of a link walk.
+type LinkStep struct {
+	Bucket string // Bucket of the links to follow, empty for any
+	Tag    string // Tag of the links to follow, empty for any
+	Keep   bool   // Return the objects reached by this step
+}
+
+// A link reached by a link walk, with the bucket type of its target.
+type linkTarget struct {
+	Link
+	Type string
+}
+
+// Adds a link to another object, unless the content already has it.
+func (c *Content) AddLink(bucket string, key string, tag string) {
+	link := Link{Bucket: bucket, Key: key, Tag: tag}
+	for _, l := range c.Links {
+		if l == link {
+			return
+		}
+	}
+
+	c.Links = append(c.Links, link)
+}
+
+// Removes a link to another object.
+func (c *Content) RemoveLink(bucket string, key string, tag string) {
+	link := Link{Bucket: bucket, Key: key, Tag: tag}
+	for i, l := range c.Links {
+		if l == link {
+			c.Links = append(c.Links[:i:i], c.Links[i+1:]...)
+			return
+		}
+	}
+}
+
+// Walks the links of an object using a Riak MapReduce request with a link
+// phase for each step. Returns the objects reached by each step, in the order
+// of the steps; steps that are not kept have no objects, except for the last
+// step which is always kept. Linked objects are fetched concurrently (see
+// GetMany) and resolved as by FetchObject; links to objects that do not exist
+// are skipped.
+func (c *Client) WalkLinks(obj *Object, steps ...LinkStep) (results [][]*Object, err error) {
+	var query []byte
+	var resps []*RpbMapRedResp
+
+	if len(steps) == 0 {
+		err = ErrNoLinkSteps
+		return
+	}
+
+	if query, err = linkWalkQuery(obj, steps); err != nil {
+		return
+	}
+
+	if resps, err = c.MapRed(&RpbMapRedReq{Request: query, ContentType: []byte("application/json")}); err != nil {
+		return
+	}
+
+	links := make([][]linkTarget, len(steps))
+	for _, resp := range resps {
+		var found []linkTarget
+
+		if resp.Phase == nil || len(resp.Response) == 0 {
+			continue
+		}
+
+		phase := int(resp.GetPhase())
+		if phase < 0 || phase >= len(steps) {
+			continue
+		}
+
+		if found, err = parseLinkResults(resp.Response); err != nil {
+			return
+		}
+
+		links[phase] = append(links[phase], found...)
+	}
+
+	results = make([][]*Object, len(steps))
+	for i := range steps {
+		if results[i], err = c.fetchLinked(links[i]); err != nil {
+			results = nil
+			return
+		}
+	}
+
+	return
+}
+
+// Fetches the distinct objects targeted by links, in order, skipping objects
+// that do not exist.
+func (c *Client) fetchLinked(links []linkTarget) (objs []*Object, err error) {
+	var buckets []linkTarget
+	keys := make(map[linkTarget][]string)
+	seen := make(map[linkTarget]bool)
+
+	for _, l := range links {
+		l.Tag = ""
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+
+		// Keys are grouped by bucket type and bucket.
+		b := linkTarget{Link: Link{Bucket: l.Bucket}, Type: l.Type}
+		if _, ok := keys[b]; !ok {
+			buckets = append(buckets, b)
+		}
+		keys[b] = append(keys[b], l.Key)
+	}
+
+	for _, b := range buckets {
+		many := c.GetMany(b.Bucket, keys[b], &GetManyOptions{Type: b.Type})
+
+		for _, key := range keys[b] {
+			r := many[key]
+			if r.Err != nil {
+				err = r.Err
+				return
+			}
+
+			if len(r.Resp.GetContent()) == 0 {
+				continue
+			}
+
+			obj := newObject(b.Type, b.Bucket, key, r.Resp)
+			if err = c.resolve(obj); err != nil {
+				return
+			}
+
+			objs = append(objs, obj)
+		}
+	}
+
+	return
+}
+
+// Returns the JSON MapReduce job walking the links of an object.
+func linkWalkQuery(obj *Object, steps []LinkStep) ([]byte, error) {
+	var bucket interface{} = obj.Bucket
+	if obj.Type != "" {
+		bucket = []string{obj.Type, obj.Bucket}
+	}
+
+	phases := make([]map[string]interface{}, len(steps))
+	for i, step := range steps {
+		link := map[string]interface{}{"keep": step.Keep || i == len(steps)-1}
+		if step.Bucket != "" {
+			link["bucket"] = step.Bucket
+		}
+		if step.Tag != "" {
+			link["tag"] = step.Tag
+		}
+
+		phases[i] = map[string]interface{}{"link": link}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"inputs": [][]interface{}{{bucket, obj.Key}},
+		"query":  phases,
+	})
+}
+
+// Parses the results of a link phase, each a JSON array of the bucket (or
+// bucket type and bucket), key and tag of a link.
+func parseLinkResults(data []byte) (links []linkTarget, err error) {
+	var results [][]json.RawMessage
+
+	if err = json.Unmarshal(data, &results); err != nil {
+		return
+	}
+
+	for _, result := range results {
+		var l linkTarget
+
+		if len(result) < 2 {
+			continue
+		}
+
+		if err = json.Unmarshal(result[0], &l.Bucket); err != nil {
+			var typed []string
+			if err = json.Unmarshal(result[0], &typed); err != nil || len(typed) != 2 {
+				err = ErrInvalidLinkResult
+				return
+			}
+			l.Type, l.Bucket = typed[0], typed[1]
+		}
+
+		if err = json.Unmarshal(result[1], &l.Key); err != nil {
+			return
+		}
+
+		if len(result) > 2 {
+			if err = json.Unmarshal(result[2], &l.Tag); err != nil {
+				return
+			}
+		}
+
+		links = append(links, l)
+	}
+
+	return
+}
@@ -0,0 +1,161 @@
+package riago
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves link walk MapReduce jobs by following the links of objects in the
+// fake store, replying with the results of each kept phase.
+func linkWalkHandler(store *fakeStore) fakeHandler {
+	return func(addr string, code byte, body []byte, reply func(byte, []byte)) {
+		if code != MsgRpbMapRedReq {
+			store.handle(addr, code, body, reply)
+			return
+		}
+
+		req := &RpbMapRedReq{}
+		proto.Unmarshal(body, req)
+
+		var job struct {
+			Inputs [][]string
+			Query  []struct {
+				Link struct {
+					Bucket string
+					Tag    string
+					Keep   bool
+				}
+			}
+		}
+		json.Unmarshal(req.Request, &job)
+
+		store.mutex.Lock()
+		defer store.mutex.Unlock()
+
+		inputs := job.Inputs
+		for i, phase := range job.Query {
+			var outputs [][]string
+
+			for _, input := range inputs {
+				if obj, ok := store.objects[input[0]+"/"+input[1]]; ok {
+					for _, l := range obj.content[0].Links {
+						if (phase.Link.Bucket == "" || phase.Link.Bucket == string(l.Bucket)) && (phase.Link.Tag == "" || phase.Link.Tag == string(l.Tag)) {
+							outputs = append(outputs, []string{string(l.Bucket), string(l.Key), string(l.Tag)})
+						}
+					}
+				}
+			}
+
+			if phase.Link.Keep && len(outputs) > 0 {
+				data, _ := json.Marshal(outputs)
+				reply(MsgRpbMapRedResp, mustMarshal(&RpbMapRedResp{Phase: proto.Uint32(uint32(i)), Response: data}))
+			}
+
+			inputs = outputs
+		}
+
+		reply(MsgRpbMapRedResp, mustMarshal(&RpbMapRedResp{Done: proto.Bool(true)}))
+	}
+}
+
+func TestObjectLinkHelpers(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewObject("people", "alice").Content()
+	c.AddLink("people", "bob", "friend")
+	c.AddLink("people", "carol", "friend")
+	c.AddLink("people", "bob", "friend")
+	assert.Equal([]Link{{"people", "bob", "friend"}, {"people", "carol", "friend"}}, c.Links)
+
+	c.RemoveLink("people", "bob", "friend")
+	c.RemoveLink("people", "dave", "friend")
+	assert.Equal([]Link{{"people", "carol", "friend"}}, c.Links)
+}
+
+func TestLinkWalkQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	query, err := linkWalkQuery(&Object{Type: "maps", Bucket: "people", Key: "alice"}, []LinkStep{
+		{Tag: "friend", Keep: false},
+		{Bucket: "pets"},
+	})
+	assert.Nil(err)
+	assert.JSONEq(`{
+		"inputs": [[["maps", "people"], "alice"]],
+		"query": [
+			{"link": {"tag": "friend", "keep": false}},
+			{"link": {"bucket": "pets", "keep": true}}
+		]
+	}`, string(query))
+
+	links, err := parseLinkResults([]byte(`[["people", "bob", "friend"], [["maps", "pets"], "rex", "pet"]]`))
+	assert.Nil(err)
+	assert.Equal([]linkTarget{{Link{"people", "bob", "friend"}, ""}, {Link{"pets", "rex", "pet"}, "maps"}}, links)
+
+	_, err = parseLinkResults([]byte(`[[1, "bob", "friend"]]`))
+	assert.Equal(ErrInvalidLinkResult, err)
+
+	_, err = parseLinkResults([]byte(`[["people", "bob", 1]]`))
+	assert.NotNil(err)
+}
+
+func TestClientWalkLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 2, fakeDialer(linkWalkHandler(store)))
+
+	alice := NewObject("people", "alice")
+	alice.Content().Value = []byte("alice")
+	alice.Content().AddLink("people", "bob", "friend")
+	alice.Content().AddLink("people", "carol", "friend")
+	alice.Content().AddLink("people", "mallory", "enemy")
+	alice.Content().AddLink("people", "zed", "friend")
+	assert.Nil(client.StoreObject(alice))
+
+	bob := NewObject("people", "bob")
+	bob.Content().Value = []byte("bob")
+	bob.Content().AddLink("pets", "rex", "pet")
+	assert.Nil(client.StoreObject(bob))
+
+	carol := NewObject("people", "carol")
+	carol.Content().Value = []byte("carol")
+	carol.Content().AddLink("pets", "rex", "pet")
+	carol.Content().AddLink("people", "alice", "friend")
+	assert.Nil(client.StoreObject(carol))
+
+	rex := NewObject("pets", "rex")
+	rex.Content().Value = []byte("rex")
+	assert.Nil(client.StoreObject(rex))
+
+	// Kept steps return their objects, skipping missing ones
+	results, err := client.WalkLinks(alice, LinkStep{Tag: "friend", Keep: true}, LinkStep{Bucket: "pets"})
+	assert.Nil(err)
+	assert.Len(results, 2)
+	assert.Len(results[0], 2)
+	assert.Equal("bob", string(results[0][0].Content().Value))
+	assert.Equal("carol", string(results[0][1].Content().Value))
+	assert.Len(results[1], 1)
+	assert.Equal("pets", results[1][0].Bucket)
+	assert.Equal("rex", string(results[1][0].Content().Value))
+
+	// Other steps return nothing
+	results, err = client.WalkLinks(alice, LinkStep{Tag: "friend"}, LinkStep{Tag: "pet"})
+	assert.Nil(err)
+	assert.Empty(results[0])
+	assert.Len(results[1], 1)
+
+	_, err = client.WalkLinks(alice)
+	assert.Equal(ErrNoLinkSteps, err)
+
+	// Linked objects are fetched from the bucket type of the link
+	objs, err := client.fetchLinked([]linkTarget{{Link{"pets", "rex", "pet"}, "animals"}, {Link{"people", "bob", "friend"}, ""}})
+	assert.Nil(err)
+	assert.Len(objs, 2)
+	assert.Equal("animals", objs[0].Type)
+	assert.Equal("rex", objs[0].Key)
+	assert.Equal("", objs[1].Type)
+}
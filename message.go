@@ -2,6 +2,8 @@ package riago
 
 import (
 	"errors"
+	"fmt"
+	"math"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -57,33 +59,96 @@ const (
 	MsgDtUpdateResp              = 83
 )
 
+// DefaultMaxFrameSize is the largest message accepted or sent on a
+// connection unless a different limit is configured.
+const DefaultMaxFrameSize = 64 * 1024 * 1024
+
 var (
 	ErrInvalidResponseBody = errors.New("invalid response body")
 	ErrInvalidResponseCode = errors.New("invalid response code")
 	ErrInvalidRequestCode  = errors.New("invalid request code")
+	ErrFrameTooLarge       = errors.New("frame too large")
+	ErrEmptyFrame          = errors.New("empty frame")
 )
 
-// Encodes a request code and proto structure into a message byte buffer
-func encode(code uint8, req proto.Message) (buf []byte, err error) {
-	var reqbuf []byte
-	var size int32
+// Message codes that may be sent by Riak in response to a request.
+var responseCodes = map[uint8]bool{
+	MsgRpbErrorResp:             true,
+	MsgRpbPingResp:              true,
+	MsgRpbGetClientIdResp:       true,
+	MsgRpbSetClientIdResp:       true,
+	MsgRpbGetServerInfoResp:     true,
+	MsgRpbGetResp:               true,
+	MsgRpbPutResp:               true,
+	MsgRpbDelResp:               true,
+	MsgRpbListBucketsResp:       true,
+	MsgRpbListKeysResp:          true,
+	MsgRpbGetBucketResp:         true,
+	MsgRpbSetBucketResp:         true,
+	MsgRpbMapRedResp:            true,
+	MsgRpbIndexResp:             true,
+	MsgRbpSearchQueryResp:       true,
+	MsgRpbResetBucketResp:       true,
+	MsgRpbCSBucketResp:          true,
+	MsgRpbCounterUpdateResp:     true,
+	MsgRpbCounterGetResp:        true,
+	MsgRpbYokozunaIndexGetResp:  true,
+	MsgRpbYokozunaSchemaGetResp: true,
+	MsgDtFetchResp:              true,
+	MsgDtUpdateResp:             true,
+}
+
+// RiakError represents an error response returned by the Riak server.
+type RiakError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *RiakError) Error() string {
+	return e.Message
+}
+
+// ProtocolError reports a response whose message code does not match the
+// request it was read for, meaning the connection is out of sync with the
+// server. The connection is discarded and redialed.
+type ProtocolError struct {
+	Expected uint8
+	Received uint8
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("protocol desync: expected response code %d, received %d", e.Expected, e.Received)
+}
+
+// Encodes a request code and proto structure into a length-prefixed message,
+// marshaling directly into the given buffer after the header.
+func encode(b *proto.Buffer, code uint8, req proto.Message) (buf []byte, err error) {
+	var size int
+
+	b.SetBuf(append(b.Bytes()[:0], 0, 0, 0, 0, code))
 
 	if req != nil {
-		if reqbuf, err = proto.Marshal(req); err != nil {
+		if err = b.Marshal(req); err != nil {
 			return
 		}
 	}
 
-	size = int32(len(reqbuf) + 1)
-	buf = []byte{byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size), code}
-	buf = append(buf, reqbuf...)
+	buf = b.Bytes()
+
+	if size = len(buf) - 4; size > math.MaxInt32 {
+		err = ErrFrameTooLarge
+		return
+	}
+
+	buf[0], buf[1], buf[2], buf[3] = byte(size>>24), byte(size>>16), byte(size>>8), byte(size)
 
 	return
 }
 
 // Decodes a message byte buffer into a proto response, error code or nil
-// Resulting object depends on response type.
-func decode(buf []byte, resp proto.Message) (err error) {
+// Resulting object depends on response type. A non-zero expect rejects any
+// response other than the expected code or an error with a *ProtocolError.
+func decode(buf []byte, expect uint8, resp proto.Message) (err error) {
 	var code uint8
 	var respbuf []byte
 
@@ -94,6 +159,16 @@ func decode(buf []byte, resp proto.Message) (err error) {
 
 	code = buf[0]
 
+	if expect != 0 && code != expect && code != MsgRpbErrorResp {
+		err = &ProtocolError{Expected: expect, Received: code}
+		return
+	}
+
+	if code != expect && !responseCodes[code] {
+		err = ErrInvalidResponseCode
+		return
+	}
+
 	if len(buf) > 1 {
 		respbuf = buf[1:]
 	} else {
@@ -104,14 +179,16 @@ func decode(buf []byte, resp proto.Message) (err error) {
 	case MsgRpbErrorResp:
 		errResp := &RpbErrorResp{}
 		if err = proto.Unmarshal(respbuf, errResp); err == nil {
-			err = errors.New(string(errResp.Errmsg))
+			err = &RiakError{Code: errResp.GetErrcode(), Message: string(errResp.GetErrmsg())}
 		}
 
 	case MsgRpbPingResp, MsgRpbSetClientIdResp, MsgRpbSetBucketResp, MsgRpbDelResp:
 		resp = nil
 
 	default:
-		err = proto.Unmarshal(respbuf, resp)
+		if resp != nil {
+			err = proto.Unmarshal(respbuf, resp)
+		}
 	}
 
 	return
@@ -0,0 +1,70 @@
+package riago
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageEncodeDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	req := &RpbGetResp{Vclock: []byte("vclock")}
+	buf, err := encode(proto.NewBuffer(nil), MsgRpbGetResp, req)
+	assert.Nil(err)
+	assert.Equal(len(buf)-4, int(buf[3]))
+
+	resp := &RpbGetResp{}
+	err = decode(buf[4:], 0, resp)
+	assert.Nil(err)
+	assert.Equal("vclock", string(resp.GetVclock()))
+}
+
+func TestMessageDecodeErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	// Empty buffers have no message code
+	err := decode([]byte{}, 0, &RpbGetResp{})
+	assert.Equal(ErrInvalidResponseCode, err)
+
+	// Unknown and request codes are rejected
+	err = decode([]byte{72}, 0, &RpbGetResp{})
+	assert.Equal(ErrInvalidResponseCode, err)
+	err = decode([]byte{MsgRpbGetReq}, 0, &RpbGetResp{})
+	assert.Equal(ErrInvalidResponseCode, err)
+
+	// Riak errors are typed
+	body, _ := proto.Marshal(&RpbErrorResp{Errmsg: []byte("notfound"), Errcode: proto.Uint32(1)})
+	err = decode(append([]byte{MsgRpbErrorResp}, body...), 0, &RpbGetResp{})
+	assert.Equal(&RiakError{Code: 1, Message: "notfound"}, err)
+
+	// Expected codes reject other responses but not errors
+	err = decode([]byte{MsgRpbPutResp}, MsgRpbGetResp, &RpbGetResp{})
+	assert.Equal(&ProtocolError{Expected: MsgRpbGetResp, Received: MsgRpbPutResp}, err)
+	err = decode(append([]byte{MsgRpbErrorResp}, body...), MsgRpbGetResp, &RpbGetResp{})
+	assert.Equal(&RiakError{Code: 1, Message: "notfound"}, err)
+
+	// Expected codes unknown to riago are accepted
+	err = decode([]byte{72}, 72, nil)
+	assert.Nil(err)
+
+	// Responses without a destination are ignored
+	err = decode([]byte{MsgRpbPutResp, 0x0a, 0x01, 'k'}, 0, nil)
+	assert.Nil(err)
+}
+
+func FuzzDecode(f *testing.F) {
+	body, _ := proto.Marshal(&RpbGetResp{Content: []*RpbContent{{Value: []byte("v")}}, Vclock: []byte("c")})
+	f.Add(append([]byte{MsgRpbGetResp}, body...))
+	f.Add([]byte{MsgRpbErrorResp, 0x0a, 0x01, 'e', 0x10, 0x01})
+	f.Add([]byte{MsgRpbPingResp})
+	f.Add([]byte{MsgRpbListKeysResp, 0x0a, 0x01, 'k', 0x10, 0x01})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		decode(buf, 0, &RpbGetResp{})
+		decode(buf, 0, &RpbListKeysResp{})
+		decode(buf, 0, nil)
+	})
+}
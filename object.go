@@ -0,0 +1,361 @@
+package riago
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnresolvedSiblings = errors.New("object has unresolved siblings")
+
+// Object represents a Riak object: its location, causal context and values.
+// An object that was not found has no siblings.
+type Object struct {
+	Type     string // Bucket type, empty for the default type
+	Bucket   string
+	Key      string
+	VClock   []byte     // Causal context to send with the next store
+	Siblings []*Content // Values of the object, more than one if in conflict
+}
+
+// Content represents a single value of a Riak object with its metadata.
+type Content struct {
+	Value           []byte
+	ContentType     string
+	Charset         string
+	ContentEncoding string
+	VTag            string              // Set by Riak
+	LastModified    time.Time           // Set by Riak
+	Deleted         bool                // Set by Riak for tombstones
+	Usermeta        map[string]string   // User metadata by key
+	Indexes         map[string][]string // Secondary index values by index name
+	Links           []Link
+}
+
+// Link represents a link from one Riak object to another.
+type Link struct {
+	Bucket string
+	Key    string
+	Tag    string
+}
+
+// Creates a new Object with the given bucket and key and a single empty value.
+func NewObject(bucket string, key string) *Object {
+	return &Object{
+		Bucket:   bucket,
+		Key:      key,
+		Siblings: []*Content{&Content{}},
+	}
+}
+
+// Returns the value of an object without siblings, adding an empty value if
+// the object has none. Returns the first sibling if the object is in
+// conflict.
+func (o *Object) Content() *Content {
+	if len(o.Siblings) == 0 {
+		o.Siblings = []*Content{&Content{}}
+	}
+
+	return o.Siblings[0]
+}
+
+// Reports whether the object has more than one value.
+func (o *Object) HasSiblings() bool {
+	return len(o.Siblings) > 1
+}
+
+// Encodes a value into the object using the codec registered for its content
+// type, defaulting to JSON (see RegisterCodec). Fields of structs tagged for
+// user metadata and indexes replace those of the object (see MarshalContent)
+// and the tagged key is used if the object has none.
+func (o *Object) Encode(v interface{}) (err error) {
+	var codec Codec
+	var key string
+	var rc *RpbContent
+	var fields []taggedField
+
+	c := o.Content()
+
+	if codec, err = LookupCodec(c.ContentType); err != nil {
+		return
+	}
+
+	if key, rc, fields, err = marshalValue(codec, v); err != nil {
+		return
+	}
+
+	c.Value = rc.Value
+	if c.ContentType == "" {
+		c.ContentType = codec.ContentType()
+	}
+
+	for _, tf := range fields {
+		if tf.meta != "" {
+			c.RemoveUsermeta(tf.meta)
+		}
+		for _, name := range tf.names {
+			c.RemoveIndex(name)
+		}
+	}
+
+	for _, p := range rc.Usermeta {
+		c.SetUsermeta(string(p.Key), string(p.Value))
+	}
+
+	for _, p := range rc.Indexes {
+		c.addIndex(string(p.Key), string(p.Value))
+	}
+
+	if o.Key == "" {
+		o.Key = key
+	}
+
+	return
+}
+
+// Decodes the value of the object into a pointer using the codec registered
+// for its content type (see RegisterCodec), setting the tagged fields of
+// structs. Returns ErrNotFound if the object has no value or is a tombstone.
+func (o *Object) Decode(v interface{}) (err error) {
+	var codec Codec
+
+	if o.HasSiblings() {
+		return ErrUnresolvedSiblings
+	}
+
+	if len(o.Siblings) == 0 || o.Siblings[0].Deleted {
+		return ErrNotFound
+	}
+
+	c := o.Siblings[0]
+
+	if codec, err = LookupCodec(c.ContentType); err != nil {
+		return
+	}
+
+	return unmarshalValue(codec, o.Key, c.proto(), v)
+}
+
+// Returns a user metadata value and whether it was set.
+func (c *Content) GetUsermeta(key string) (value string, ok bool) {
+	value, ok = c.Usermeta[key]
+	return
+}
+
+// Sets a user metadata value.
+func (c *Content) SetUsermeta(key string, value string) {
+	if c.Usermeta == nil {
+		c.Usermeta = make(map[string]string)
+	}
+	c.Usermeta[key] = value
+}
+
+// Removes a user metadata value.
+func (c *Content) RemoveUsermeta(key string) {
+	delete(c.Usermeta, key)
+}
+
+// Adds a value to an integer index. The "_int" suffix is added to the index
+// name if missing.
+func (c *Content) AddIntIndex(name string, value int64) {
+	c.addIndex(indexName(name, "_int"), strconv.FormatInt(value, 10))
+}
+
+// Removes a value from an integer index.
+func (c *Content) RemoveIntIndex(name string, value int64) {
+	c.removeIndex(indexName(name, "_int"), strconv.FormatInt(value, 10))
+}
+
+// Returns the values of an integer index, skipping any that do not parse.
+func (c *Content) IntIndex(name string) (values []int64) {
+	for _, s := range c.Indexes[indexName(name, "_int")] {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			values = append(values, v)
+		}
+	}
+
+	return
+}
+
+// Adds a value to a binary index. The "_bin" suffix is added to the index
+// name if missing.
+func (c *Content) AddBinIndex(name string, value string) {
+	c.addIndex(indexName(name, "_bin"), value)
+}
+
+// Removes a value from a binary index.
+func (c *Content) RemoveBinIndex(name string, value string) {
+	c.removeIndex(indexName(name, "_bin"), value)
+}
+
+// Returns the values of a binary index.
+func (c *Content) BinIndex(name string) []string {
+	return c.Indexes[indexName(name, "_bin")]
+}
+
+// Removes every value of an index, given its full name.
+func (c *Content) RemoveIndex(name string) {
+	delete(c.Indexes, name)
+}
+
+func (c *Content) addIndex(name string, value string) {
+	for _, v := range c.Indexes[name] {
+		if v == value {
+			return
+		}
+	}
+
+	if c.Indexes == nil {
+		c.Indexes = make(map[string][]string)
+	}
+	c.Indexes[name] = append(c.Indexes[name], value)
+}
+
+func (c *Content) removeIndex(name string, value string) {
+	values := c.Indexes[name]
+	for i, v := range values {
+		if v == value {
+			values = append(values[:i:i], values[i+1:]...)
+			break
+		}
+	}
+
+	if len(values) == 0 {
+		delete(c.Indexes, name)
+	} else {
+		c.Indexes[name] = values
+	}
+}
+
+// Returns the index name with the given suffix, adding it if missing.
+func indexName(name string, suffix string) string {
+	if strings.HasSuffix(name, suffix) {
+		return name
+	}
+
+	return name + suffix
+}
+
+// Creates a new Object from a Riak Get response.
+func newObject(typ string, bucket string, key string, resp *RpbGetResp) *Object {
+	obj := &Object{
+		Type:     typ,
+		Bucket:   bucket,
+		Key:      key,
+		VClock:   resp.GetVclock(),
+		Siblings: make([]*Content, len(resp.GetContent())),
+	}
+
+	for i, rc := range resp.GetContent() {
+		obj.Siblings[i] = newContent(rc)
+	}
+
+	return obj
+}
+
+// Creates a new Content from its protobuf representation.
+func newContent(rc *RpbContent) *Content {
+	c := &Content{
+		Value:           rc.GetValue(),
+		ContentType:     string(rc.GetContentType()),
+		Charset:         string(rc.GetCharset()),
+		ContentEncoding: string(rc.GetContentEncoding()),
+		VTag:            string(rc.GetVtag()),
+		Deleted:         rc.GetDeleted(),
+	}
+
+	if rc.LastMod != nil {
+		c.LastModified = time.Unix(int64(rc.GetLastMod()), int64(rc.GetLastModUsecs())*1000)
+	}
+
+	for _, p := range rc.GetUsermeta() {
+		c.SetUsermeta(string(p.GetKey()), string(p.GetValue()))
+	}
+
+	for _, p := range rc.GetIndexes() {
+		c.addIndex(string(p.GetKey()), string(p.GetValue()))
+	}
+
+	for _, l := range rc.GetLinks() {
+		c.Links = append(c.Links, Link{Bucket: string(l.GetBucket()), Key: string(l.GetKey()), Tag: string(l.GetTag())})
+	}
+
+	return c
+}
+
+// Returns the protobuf representation of the content. Metadata set by Riak
+// is omitted and user metadata and indexes are sorted by key.
+func (c *Content) proto() *RpbContent {
+	rc := &RpbContent{Value: c.Value}
+
+	if rc.Value == nil {
+		rc.Value = []byte{}
+	}
+	if c.ContentType != "" {
+		rc.ContentType = []byte(c.ContentType)
+	}
+	if c.Charset != "" {
+		rc.Charset = []byte(c.Charset)
+	}
+	if c.ContentEncoding != "" {
+		rc.ContentEncoding = []byte(c.ContentEncoding)
+	}
+
+	for _, k := range sortedKeys(c.Usermeta) {
+		rc.Usermeta = append(rc.Usermeta, &RpbPair{Key: []byte(k), Value: []byte(c.Usermeta[k])})
+	}
+
+	names := make([]string, 0, len(c.Indexes))
+	for name := range c.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, v := range c.Indexes[name] {
+			rc.Indexes = append(rc.Indexes, &RpbPair{Key: []byte(name), Value: []byte(v)})
+		}
+	}
+
+	for _, l := range c.Links {
+		rc.Links = append(rc.Links, &RpbLink{Bucket: []byte(l.Bucket), Key: []byte(l.Key), Tag: []byte(l.Tag)})
+	}
+
+	return rc
+}
+
+// Returns a Riak Put request storing the object, which must not have
+// siblings.
+func (o *Object) putReq() (req *RpbPutReq, err error) {
+	if o.HasSiblings() {
+		err = ErrUnresolvedSiblings
+		return
+	}
+
+	req = &RpbPutReq{
+		Bucket:  []byte(o.Bucket),
+		Vclock:  o.VClock,
+		Content: o.Content().proto(),
+	}
+
+	if o.Key != "" {
+		req.Key = []byte(o.Key)
+	}
+	if o.Type != "" {
+		req.Type = []byte(o.Type)
+	}
+
+	return
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,269 @@
+package riago
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// An in-memory Riak KV store. Stores with a stale vclock create siblings and
+// objects whose siblings are all tombstones are only visible through their
+// vclock when requested.
+type fakeStore struct {
+	mutex   sync.Mutex
+	objects map[string]*fakeObject
+	clock   int
+	puts    int
+	dels    []*RpbDelReq
+}
+
+type fakeObject struct {
+	vclock  []byte
+	content []*RpbContent
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{objects: make(map[string]*fakeObject)}
+}
+
+// Seeds an object with the given siblings, returning its vclock.
+func (s *fakeStore) seed(bucket string, key string, content ...*RpbContent) []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.clock += 1
+	obj := &fakeObject{vclock: []byte(fmt.Sprintf("v%d", s.clock)), content: content}
+	s.objects[bucket+"/"+key] = obj
+
+	return obj.vclock
+}
+
+// Returns the stored siblings of an object.
+func (s *fakeStore) get(bucket string, key string) []*RpbContent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if obj, ok := s.objects[bucket+"/"+key]; ok {
+		return obj.content
+	}
+
+	return nil
+}
+
+func (s *fakeStore) handle(addr string, code byte, body []byte, reply func(byte, []byte)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch code {
+	case MsgRpbGetReq:
+		req := &RpbGetReq{}
+		proto.Unmarshal(body, req)
+		resp := &RpbGetResp{}
+		if obj, ok := s.objects[string(req.Bucket)+"/"+string(req.Key)]; ok {
+			if len(withoutTombstones(obj.content)) > 0 {
+				resp.Vclock, resp.Content = obj.vclock, obj.content
+			} else if req.GetDeletedvclock() {
+				resp.Vclock = obj.vclock
+			}
+		}
+		reply(MsgRpbGetResp, mustMarshal(resp))
+
+	case MsgRpbPutReq:
+		req := &RpbPutReq{}
+		proto.Unmarshal(body, req)
+		s.puts += 1
+
+		key := string(req.Key)
+		if key == "" {
+			key = fmt.Sprintf("generated%d", s.puts)
+		}
+
+		obj, ok := s.objects[string(req.Bucket)+"/"+key]
+		if req.GetIfNoneMatch() && ok {
+			reply(MsgRpbErrorResp, mustMarshal(&RpbErrorResp{Errmsg: []byte("match_found"), Errcode: proto.Uint32(0)}))
+			return
+		}
+		if req.GetIfNotModified() && (!ok || string(obj.vclock) != string(req.Vclock)) {
+			reply(MsgRpbErrorResp, mustMarshal(&RpbErrorResp{Errmsg: []byte("modified"), Errcode: proto.Uint32(0)}))
+			return
+		}
+
+		content := req.Content
+		content.LastMod = proto.Uint32(uint32(time.Now().Unix()))
+
+		if !ok {
+			obj = &fakeObject{}
+			s.objects[string(req.Bucket)+"/"+key] = obj
+		}
+
+		if ok && string(obj.vclock) != string(req.Vclock) {
+			obj.content = append(obj.content, content)
+		} else {
+			obj.content = []*RpbContent{content}
+		}
+
+		s.clock += 1
+		obj.vclock = []byte(fmt.Sprintf("v%d", s.clock))
+
+		resp := &RpbPutResp{Vclock: obj.vclock}
+		if len(req.Key) == 0 {
+			resp.Key = []byte(key)
+		}
+		if req.GetReturnBody() {
+			resp.Content = obj.content
+		} else if req.GetReturnHead() {
+			for _, c := range obj.content {
+				head := *c
+				head.Value = nil
+				resp.Content = append(resp.Content, &head)
+			}
+		}
+		reply(MsgRpbPutResp, mustMarshal(resp))
+
+	case MsgRpbDelReq:
+		req := &RpbDelReq{}
+		proto.Unmarshal(body, req)
+		s.dels = append(s.dels, req)
+		delete(s.objects, string(req.Bucket)+"/"+string(req.Key))
+		reply(MsgRpbDelResp, nil)
+
+	default:
+		reply(code+1, nil)
+	}
+}
+
+func TestObjectContentHelpers(t *testing.T) {
+	assert := assert.New(t)
+
+	obj := NewObject("users", "bob")
+	c := obj.Content()
+	c.ContentType = "application/json"
+
+	c.SetUsermeta("owner", "alice")
+	v, ok := c.GetUsermeta("owner")
+	assert.True(ok)
+	assert.Equal("alice", v)
+	c.RemoveUsermeta("owner")
+	_, ok = c.GetUsermeta("owner")
+	assert.False(ok)
+
+	c.AddIntIndex("age", 42)
+	c.AddIntIndex("age_int", 43)
+	c.AddIntIndex("age", 42)
+	assert.Equal([]int64{42, 43}, c.IntIndex("age"))
+	c.RemoveIntIndex("age", 42)
+	assert.Equal([]int64{43}, c.IntIndex("age_int"))
+	c.RemoveIntIndex("age", 43)
+	assert.Nil(c.Indexes["age_int"])
+
+	c.AddBinIndex("email", "bob@example.com")
+	assert.Equal([]string{"bob@example.com"}, c.BinIndex("email_bin"))
+	c.RemoveIndex("email_bin")
+	assert.Empty(c.Indexes)
+
+	assert.False(obj.HasSiblings())
+	assert.Equal(c, obj.Content())
+}
+
+func TestObjectProtoConversion(t *testing.T) {
+	assert := assert.New(t)
+
+	resp := &RpbGetResp{
+		Vclock: []byte("vclock"),
+		Content: []*RpbContent{
+			{
+				Value:        []byte("one"),
+				ContentType:  []byte("text/plain"),
+				Charset:      []byte("utf-8"),
+				Vtag:         []byte("tag"),
+				LastMod:      proto.Uint32(1400000000),
+				LastModUsecs: proto.Uint32(500),
+				Usermeta:     []*RpbPair{{Key: []byte("owner"), Value: []byte("alice")}},
+				Indexes:      []*RpbPair{{Key: []byte("age_int"), Value: []byte("42")}, {Key: []byte("age_int"), Value: []byte("43")}},
+				Links:        []*RpbLink{{Bucket: []byte("users"), Key: []byte("carol"), Tag: []byte("friend")}},
+			},
+			{Value: []byte{}, Deleted: proto.Bool(true)},
+		},
+	}
+
+	obj := newObject("maps", "users", "bob", resp)
+	assert.Equal("maps", obj.Type)
+	assert.Equal("vclock", string(obj.VClock))
+	assert.True(obj.HasSiblings())
+
+	c := obj.Siblings[0]
+	assert.Equal("one", string(c.Value))
+	assert.Equal("text/plain", c.ContentType)
+	assert.Equal("utf-8", c.Charset)
+	assert.Equal("tag", c.VTag)
+	assert.Equal(time.Unix(1400000000, 500000), c.LastModified)
+	assert.Equal(map[string]string{"owner": "alice"}, c.Usermeta)
+	assert.Equal([]int64{42, 43}, c.IntIndex("age"))
+	assert.Equal([]Link{{Bucket: "users", Key: "carol", Tag: "friend"}}, c.Links)
+	assert.False(c.Deleted)
+	assert.True(obj.Siblings[1].Deleted)
+
+	// Objects in conflict cannot be stored
+	_, err := obj.putReq()
+	assert.Equal(ErrUnresolvedSiblings, err)
+
+	obj.Siblings = obj.Siblings[:1]
+	req, err := obj.putReq()
+	assert.Nil(err)
+	assert.Equal("maps", string(req.Type))
+	assert.Equal("vclock", string(req.Vclock))
+	assert.Equal(resp.Content[0].Indexes, req.Content.Indexes)
+	assert.Equal(resp.Content[0].Usermeta, req.Content.Usermeta)
+	assert.Equal(resp.Content[0].Links, req.Content.Links)
+	assert.Nil(req.Content.Vtag)
+	assert.Nil(req.Content.LastMod)
+}
+
+func TestClientFetchStoreObject(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+
+	// Missing objects have no siblings
+	obj, err := client.FetchObject(&RpbGetReq{Bucket: []byte("users"), Key: []byte("bob")})
+	assert.Nil(err)
+	assert.Empty(obj.Siblings)
+	assert.Equal("bob", obj.Key)
+
+	obj.Content().Value = []byte("v1")
+	obj.Content().SetUsermeta("owner", "alice")
+	assert.Nil(client.StoreObject(obj))
+	assert.NotEmpty(obj.VClock)
+
+	// Storing with the fetched vclock replaces the value
+	obj, err = client.FetchObject(&RpbGetReq{Bucket: []byte("users"), Key: []byte("bob")})
+	assert.Nil(err)
+	assert.Equal("v1", string(obj.Content().Value))
+	assert.False(obj.Content().LastModified.IsZero())
+	obj.Content().Value = []byte("v2")
+	assert.Nil(client.StoreObject(obj))
+	assert.Len(store.get("users", "bob"), 1)
+
+	// Riak assigns keys to objects stored without one
+	obj = NewObject("users", "")
+	assert.Nil(client.StoreObject(obj))
+	assert.Equal("generated3", obj.Key)
+
+	// Stores creating siblings give the object every sibling
+	obj, err = client.FetchObject(&RpbGetReq{Bucket: []byte("users"), Key: []byte("bob")})
+	assert.Nil(err)
+	vclock := obj.VClock
+	store.seed("users", "bob", &RpbContent{Value: []byte("theirs")})
+	obj.Content().Value = []byte("mine")
+	assert.Nil(client.StoreObject(obj))
+	assert.Len(obj.Siblings, 2)
+	assert.Equal("theirs", string(obj.Siblings[0].Value))
+	assert.Equal("mine", string(obj.Siblings[1].Value))
+	assert.NotEqual(vclock, obj.VClock)
+	assert.Equal(ErrUnresolvedSiblings, client.StoreObject(obj))
+}
@@ -0,0 +1,308 @@
+package riago
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var (
+	ErrPipelineTimeout     = errors.New("pipelined request timed out")
+	ErrUnexpectedResponse  = errors.New("unexpected response on pipelined connection")
+	errPipelineUnavailable = errors.New("pipeline unavailable")
+)
+
+// A request waiting for its responses on a pipelined connection, expecting
+// responses with the given code (any if zero). Responses are allocated by
+// next and either merged into resp or, for streaming requests, passed to
+// handle until isDone reports true. Responses are only delivered until the
+// call is finished, as its caller may then reuse resp for a retry.
+type pipelineCall struct {
+	expect   byte
+	resp     proto.Message
+	next     func() proto.Message
+	isDone   func(proto.Message) bool
+	handle   func(proto.Message) error
+	err      error
+	mutex    sync.Mutex
+	finished bool
+	done     chan error
+}
+
+// A single socket shared by concurrent requests. Requests are written in
+// order and responses are matched to them first-in first-out, as Riak
+// answers requests on a connection in order. Any socket or protocol error
+// poisons the connection, failing every request in flight.
+type pipelineConn struct {
+	conn  *Conn
+	mutex sync.Mutex
+	queue []*pipelineCall
+	err   error
+}
+
+// Manages a pipelined connection to a single address, redialing after the
+// connection is poisoned. Depth bounds the number of requests in flight.
+type pipeline struct {
+	addr       string
+	dialer     DialFunc
+	slots      chan struct{}
+	writeMutex sync.Mutex
+	current    *pipelineConn
+}
+
+// Create a new pipeline for the given address and depth.
+func newPipeline(addr string, dial DialFunc, depth int) *pipeline {
+	if depth < 1 {
+		depth = 1
+	}
+
+	return &pipeline{
+		addr:   addr,
+		dialer: dial,
+		slots:  make(chan struct{}, depth),
+	}
+}
+
+// Performs a request on the pipeline, blocking until all of its responses
+// have been handled, the read timeout expires or the connection fails.
+func (p *pipeline) call(c *Client, call *Call, pcall *pipelineCall) (err error) {
+	var pc *pipelineConn
+
+	prof := call.Profile
+	pcall.done = make(chan error, 1)
+
+	// Optimistically try a non-blocking send to avoid a timer.
+	t := time.Now()
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		select {
+		case p.slots <- struct{}{}:
+		case <-time.After(c.pool.waitTimeout):
+			return ErrPoolWaitTimeout
+		}
+	}
+	defer func() { <-p.slots }()
+	prof.ConnWait = time.Now().Sub(t)
+
+	// Enqueue and write under the write lock so the queue order matches the
+	// order of requests on the wire.
+	t = time.Now()
+	p.writeMutex.Lock()
+
+	if pc, err = p.connect(c); err != nil {
+		p.writeMutex.Unlock()
+		return
+	}
+
+	if err = pc.enqueue(pcall); err != nil {
+		p.writeMutex.Unlock()
+		return
+	}
+
+	call.Conn = pc.conn
+	pc.conn.writeTimeout = c.writeTimeout
+	err = pc.conn.request(call.Code, call.Req)
+	prof.written = pc.conn.written
+	p.writeMutex.Unlock()
+
+	if err != nil {
+		pc.poison(err)
+		return <-pcall.done
+	}
+	prof.Request = time.Now().Sub(t)
+
+	t = time.Now()
+	if c.readTimeout > 0 {
+		timer := time.NewTimer(c.readTimeout)
+		defer timer.Stop()
+
+		select {
+		case err = <-pcall.done:
+		case <-timer.C:
+			// A missing response stalls every request behind it.
+			pc.poison(ErrPipelineTimeout)
+			err = <-pcall.done
+		}
+	} else {
+		err = <-pcall.done
+	}
+	prof.Response = time.Now().Sub(t)
+
+	return
+}
+
+// Returns the current connection, dialing a new one if there is none or the
+// previous one was poisoned. Must be called with the write lock held.
+func (p *pipeline) connect(c *Client) (pc *pipelineConn, err error) {
+	if p.current != nil && !p.current.failed() {
+		return p.current, nil
+	}
+
+	conn := NewConnWithDialer(p.addr, p.dialer)
+	conn.maxFrameSize = c.maxFrameSize
+
+	if err = conn.Recover(); err != nil {
+		return
+	}
+
+	pc = &pipelineConn{conn: conn}
+	go pc.readLoop()
+	p.current = pc
+
+	return
+}
+
+// Closes the current connection, failing any requests in flight.
+func (p *pipeline) close() {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+
+	if p.current != nil {
+		p.current.poison(errPipelineUnavailable)
+		p.current = nil
+	}
+}
+
+// Adds a request to the tail of the queue unless the connection has failed.
+func (pc *pipelineConn) enqueue(call *pipelineCall) error {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if pc.err != nil {
+		return pc.err
+	}
+
+	pc.queue = append(pc.queue, call)
+
+	return nil
+}
+
+// Returns the request at the head of the queue, or nil if there is none.
+func (pc *pipelineConn) head() *pipelineCall {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if len(pc.queue) == 0 {
+		return nil
+	}
+
+	return pc.queue[0]
+}
+
+// Removes the request at the head of the queue and completes it.
+func (pc *pipelineConn) complete(call *pipelineCall, err error) {
+	pc.mutex.Lock()
+	if len(pc.queue) == 0 || pc.queue[0] != call {
+		// Already failed by poison.
+		pc.mutex.Unlock()
+		return
+	}
+	pc.queue[0] = nil
+	pc.queue = pc.queue[1:]
+	pc.mutex.Unlock()
+
+	call.finish(err)
+}
+
+// Reports whether the connection has been poisoned.
+func (pc *pipelineConn) failed() bool {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	return pc.err != nil
+}
+
+// Marks the connection as failed, closes the socket and fails every request
+// in flight with the given error.
+func (pc *pipelineConn) poison(err error) {
+	pc.mutex.Lock()
+	if pc.err == nil {
+		pc.err = err
+	}
+	calls := pc.queue
+	pc.queue = nil
+	pc.mutex.Unlock()
+
+	pc.conn.interrupt()
+
+	for _, call := range calls {
+		call.finish(err)
+	}
+}
+
+// Reports the outcome of the call to its caller, unless it already finished.
+func (call *pipelineCall) finish(err error) {
+	call.mutex.Lock()
+	defer call.mutex.Unlock()
+
+	if !call.finished {
+		call.finished = true
+		call.done <- err
+	}
+}
+
+// Delivers a response to the call unless it already finished.
+func (call *pipelineCall) deliver(resp proto.Message) {
+	call.mutex.Lock()
+	defer call.mutex.Unlock()
+
+	if call.finished {
+		return
+	}
+
+	// A streaming request keeps consuming responses after its handler
+	// fails so the connection stays in sync.
+	if call.handle != nil {
+		if call.err == nil {
+			call.err = call.handle(resp)
+		}
+	} else if call.resp != nil {
+		call.resp.Reset()
+		proto.Merge(call.resp, resp)
+	}
+}
+
+// Reads responses and dispatches them to the request at the head of the
+// queue until the connection fails.
+func (pc *pipelineConn) readLoop() {
+	b := proto.NewBuffer(nil)
+
+	for {
+		buf, err := pc.conn.read(b)
+		if err != nil {
+			pc.poison(err)
+			return
+		}
+
+		call := pc.head()
+		if call == nil {
+			pc.poison(ErrUnexpectedResponse)
+			return
+		}
+
+		var resp proto.Message
+		if call.next != nil {
+			resp = call.next()
+		}
+
+		if err = decode(buf, call.expect, resp); err != nil {
+			if _, ok := err.(*RiakError); ok {
+				// Riak answers a failed request with a single error.
+				pc.complete(call, err)
+				continue
+			}
+
+			pc.poison(err)
+			return
+		}
+
+		call.deliver(resp)
+
+		if call.isDone == nil || call.isDone(resp) {
+			pc.complete(call, call.err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package riago
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// Echoes get keys back as vclocks, delaying the "slow" key, closing the
+// connection on the "close" key and streaming list keys in three parts.
+func pipelineHandler(addr string, code byte, body []byte, reply func(byte, []byte)) {
+	switch code {
+	case MsgRpbGetReq:
+		req := &RpbGetReq{}
+		proto.Unmarshal(body, req)
+
+		switch string(req.GetKey()) {
+		case "slow":
+			time.Sleep(100 * time.Millisecond)
+		case "close":
+			reply(MsgRpbGetResp, []byte{0xff})
+			return
+		case "missing":
+			reply(MsgRpbErrorResp, mustMarshal(&RpbErrorResp{Errmsg: []byte("notfound"), Errcode: proto.Uint32(0)}))
+			return
+		}
+
+		reply(MsgRpbGetResp, mustMarshal(&RpbGetResp{Vclock: req.GetKey()}))
+
+	case MsgRpbListKeysReq:
+		reply(MsgRpbListKeysResp, mustMarshal(&RpbListKeysResp{Keys: [][]byte{[]byte("a")}}))
+		reply(MsgRpbListKeysResp, mustMarshal(&RpbListKeysResp{Keys: [][]byte{[]byte("b")}}))
+		reply(MsgRpbListKeysResp, mustMarshal(&RpbListKeysResp{Done: proto.Bool(true)}))
+
+	default:
+		reply(code+1, nil)
+	}
+}
+
+func TestPipelineConcurrentRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, stop := fakeListener(pipelineHandler)
+	defer stop()
+
+	client := NewClient(addr, 1)
+	client.SetPipelining(1, 32)
+
+	n := 20
+	var wg sync.WaitGroup
+
+	// The slow request holds up every response behind it
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("slow")})
+		assert.Nil(err)
+		assert.Equal("slow", string(resp.GetVclock()))
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key_%d", i)
+			resp, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte(key)})
+			assert.Nil(err)
+			assert.Equal(key, string(resp.GetVclock()))
+		}(i)
+	}
+
+	// Every request is in flight on the one socket
+	time.Sleep(50 * time.Millisecond)
+	client.pipelines[0].writeMutex.Lock()
+	pc := client.pipelines[0].current
+	client.pipelines[0].writeMutex.Unlock()
+	pc.mutex.Lock()
+	assert.Equal(n+1, len(pc.queue))
+	pc.mutex.Unlock()
+
+	wg.Wait()
+}
+
+func TestPipelineStreamingAndErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, stop := fakeListener(pipelineHandler)
+	defer stop()
+
+	client := NewClient(addr, 1)
+	client.SetPipelining(1, 8)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			resps, err := client.ListKeys(&RpbListKeysReq{Bucket: []byte("b")})
+			assert.Nil(err)
+			assert.Equal(3, len(resps))
+			assert.Equal("a", string(resps[0].GetKeys()[0]))
+			assert.Equal("b", string(resps[1].GetKeys()[0]))
+		}()
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key_%d", i)
+			resp, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte(key)})
+			assert.Nil(err)
+			assert.Equal(key, string(resp.GetVclock()))
+		}(i)
+	}
+	wg.Wait()
+
+	// Riak errors fail only their own request
+	_, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("missing")})
+	assert.Equal(&RiakError{Code: 0, Message: "notfound"}, err)
+	assert.False(client.pipelines[0].current.failed())
+
+	resp, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("after")})
+	assert.Nil(err)
+	assert.Equal("after", string(resp.GetVclock()))
+}
+
+func TestPipelinePoisoning(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, stop := fakeListener(pipelineHandler)
+	defer stop()
+
+	client := NewClient(addr, 1)
+	client.SetPipelining(1, 8)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+
+	// A corrupt response poisons every request in flight behind it
+	for _, key := range []string{"slow", "close", "a", "b"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			_, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte(key)})
+			errs <- err
+		}(key)
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+	close(errs)
+
+	failed := 0
+	for err := range errs {
+		if err != nil {
+			failed += 1
+		}
+	}
+	assert.Equal(3, failed)
+
+	// The next request redials
+	resp, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("again")})
+	assert.Nil(err)
+	assert.Equal("again", string(resp.GetVclock()))
+}
+
+func TestPipelineReadTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, stop := fakeListener(pipelineHandler)
+	defer stop()
+
+	client := NewClient(addr, 1)
+	client.SetPipelining(1, 8)
+	client.SetReadTimeout(20 * time.Millisecond)
+
+	_, err := client.Get(&RpbGetReq{Bucket: []byte("b"), Key: []byte("slow")})
+	assert.Equal(ErrPipelineTimeout, err)
+
+	client.SetPipelining(0, 0)
+	assert.Nil(client.pipelines)
+}
+
+func TestPipelineCallFinished(t *testing.T) {
+	assert := assert.New(t)
+
+	// Responses are merged into the caller's response while it waits
+	resp := &RpbGetResp{Vclock: []byte("stale")}
+	call := &pipelineCall{resp: resp, done: make(chan error, 1)}
+	call.deliver(&RpbGetResp{Vclock: []byte("fresh")})
+	assert.Equal("fresh", string(resp.GetVclock()))
+
+	// Once finished, such as after a read timeout, the caller may reuse its
+	// response and late responses are dropped
+	call.finish(ErrPipelineTimeout)
+	call.finish(nil)
+	assert.Equal(ErrPipelineTimeout, <-call.done)
+
+	call.deliver(&RpbGetResp{Vclock: []byte("late")})
+	assert.Equal("fresh", string(resp.GetVclock()))
+
+	handled := 0
+	call = &pipelineCall{handle: func(proto.Message) error { handled += 1; return nil }, done: make(chan error, 1)}
+	call.deliver(&RpbListKeysResp{})
+	call.finish(ErrPipelineTimeout)
+	call.deliver(&RpbListKeysResp{})
+	assert.Equal(1, handled)
+}
@@ -14,6 +14,9 @@ var (
 
 // Pool represents a pool of connections to Riak hosts.
 type Pool struct {
+	stats       poolStats // First so its 64-bit counters are aligned on 32-bit targets
+	addrs       []string
+	dial        DialFunc
 	count       int
 	closing     int32
 	conns       chan *Conn
@@ -21,20 +24,78 @@ type Pool struct {
 	waitTimeout time.Duration
 }
 
+// PoolStats represents a snapshot of pool counters and gauges.
+type PoolStats struct {
+	Open         int           // Connections currently established
+	Idle         int           // Connections available in the pool
+	InUse        int           // Connections checked out of the pool
+	Recovering   int           // Failed connections being recovered
+	Waiting      int           // Callers currently waiting in Get
+	WaitCount    int64         // Total number of Gets that had to wait
+	WaitDuration time.Duration // Total time spent waiting in Get
+	WaitTimeouts int64         // Total number of Gets that timed out
+	Dials        int64         // Total number of dial attempts
+	DialFailures int64         // Total number of failed dial attempts
+	Pings        int64         // Total number of pings issued
+	PingFailures int64         // Total number of failed pings
+}
+
+type poolStats struct {
+	waitCount    int64
+	waitDuration int64
+	waitTimeouts int64
+	dials        int64
+	dialFailures int64
+	pings        int64
+	pingFailures int64
+	recovering   int32
+	waiting      int32
+}
+
 // Creates a new Pool for a given host and connection count.
 // Dials all connections before returning to prevent a stampede.
 // Connections that fail to connect will retry in the background.
 func NewPool(addr string, count int) (p *Pool) {
+	return NewPoolWithDialer(addr, count, nil)
+}
+
+// Creates a new Pool for a given host and connection count, establishing
+// connections with a custom dial function (see DialFunc).
+func NewPoolWithDialer(addr string, count int, dial DialFunc) (p *Pool) {
+	return NewClusterPool([]string{addr}, count, dial)
+}
+
+// Creates a new Pool for multiple Riak nodes, spreading the connection count
+// evenly across the given addresses. A nil dial function uses the default.
+// Connections are dialed concurrently, each within DefaultDialTimeout.
+func NewClusterPool(addrs []string, count int, dial DialFunc) (p *Pool) {
 	p = &Pool{
+		addrs:       addrs,
+		dial:        dial,
 		count:       count,
 		conns:       make(chan *Conn, count),
 		waitTimeout: 5 * time.Second,
 	}
 
+	// Connections are dialed concurrently so an unreachable node costs a
+	// single dial timeout, then queued in address order.
+	var wg sync.WaitGroup
+	conns := make([]*Conn, count)
+	errs := make([]error, count)
+
+	wg.Add(count)
 	for i := 0; i < count; i++ {
-		c := NewConn(addr)
+		conns[i] = NewConnWithDialer(addrs[i%len(addrs)], dial)
+
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = p.recover(conns[i])
+		}(i)
+	}
+	wg.Wait()
 
-		if err := c.Recover(); err != nil {
+	for i, c := range conns {
+		if errs[i] != nil {
 			p.Fail(c)
 		} else {
 			p.Put(c)
@@ -76,14 +137,78 @@ func (p *Pool) Get() (c *Conn, err error) {
 	}
 
 	// Fall back to waiting on a timer.
+	t := time.Now()
+	atomic.AddInt32(&p.stats.waiting, 1)
+	atomic.AddInt64(&p.stats.waitCount, 1)
+
 	select {
 	case c = <-p.conns:
 		break
 	case <-time.After(p.waitTimeout):
+		atomic.AddInt64(&p.stats.waitTimeouts, 1)
 		err = ErrPoolWaitTimeout
 		break
 	}
 
+	atomic.AddInt32(&p.stats.waiting, -1)
+	atomic.AddInt64(&p.stats.waitDuration, int64(time.Now().Sub(t)))
+
+	return
+}
+
+// Returns a snapshot of the pool counters and gauges.
+func (p *Pool) Stats() (s PoolStats) {
+	s.Idle = len(p.conns)
+	s.Recovering = int(atomic.LoadInt32(&p.stats.recovering))
+	s.Open = p.count - s.Recovering
+	s.InUse = s.Open - s.Idle
+	if s.InUse < 0 {
+		s.InUse = 0
+	}
+	s.Waiting = int(atomic.LoadInt32(&p.stats.waiting))
+	s.WaitCount = atomic.LoadInt64(&p.stats.waitCount)
+	s.WaitDuration = time.Duration(atomic.LoadInt64(&p.stats.waitDuration))
+	s.WaitTimeouts = atomic.LoadInt64(&p.stats.waitTimeouts)
+	s.Dials = atomic.LoadInt64(&p.stats.dials)
+	s.DialFailures = atomic.LoadInt64(&p.stats.dialFailures)
+	s.Pings = atomic.LoadInt64(&p.stats.pings)
+	s.PingFailures = atomic.LoadInt64(&p.stats.pingFailures)
+
+	return
+}
+
+// Get an idle connection without waiting, preferring one to a host other
+// than the given address. Returns nil if no connection is idle.
+func (p *Pool) getIdle(addr string) (c *Conn) {
+	if p.isClosing() {
+		return
+	}
+
+	skipped := make([]*Conn, 0)
+
+loop:
+	for i := 0; i < p.count; i++ {
+		select {
+		case conn := <-p.conns:
+			if conn.addr != addr {
+				c = conn
+				break loop
+			}
+			skipped = append(skipped, conn)
+		default:
+			break loop
+		}
+	}
+
+	// Fall back to another connection to the same host.
+	if c == nil && len(skipped) > 0 {
+		c, skipped = skipped[0], skipped[1:]
+	}
+
+	for _, conn := range skipped {
+		p.Put(conn)
+	}
+
 	return
 }
 
@@ -97,27 +222,41 @@ func (p *Pool) Put(c *Conn) {
 // that attempts to recover the connection. It is not made
 // available to the pool while failed.
 func (p *Pool) Fail(c *Conn) {
+	atomic.AddInt32(&p.stats.recovering, 1)
+
 	go func() {
 		var err error
 		i := 0
 		for {
 			i++
 			if p.isClosing() {
+				atomic.AddInt32(&p.stats.recovering, -1)
 				p.Put(c)
 				return
 			}
 
-			if err = c.Recover(); err != nil {
+			if err = p.recover(c); err != nil {
 				time.Sleep(1 * time.Second)
 				continue
 			}
 
+			atomic.AddInt32(&p.stats.recovering, -1)
 			p.Put(c)
 			return
 		}
 	}()
 }
 
+// Recovers a connection, counting the dial attempt and its outcome.
+func (p *Pool) recover(c *Conn) (err error) {
+	atomic.AddInt64(&p.stats.dials, 1)
+	if err = c.Recover(); err != nil {
+		atomic.AddInt64(&p.stats.dialFailures, 1)
+	}
+
+	return
+}
+
 func (p *Pool) pinger() {
 	t := time.NewTicker(time.Duration(10000.0/p.count) * time.Millisecond)
 	for {
@@ -129,7 +268,9 @@ func (p *Pool) pinger() {
 		}
 
 		if c, err := p.Get(); err == nil {
+			atomic.AddInt64(&p.stats.pings, 1)
 			if err = c.Ping(); err != nil {
+				atomic.AddInt64(&p.stats.pingFailures, 1)
 				p.Fail(c)
 			} else {
 				p.Put(c)
@@ -137,6 +278,7 @@ func (p *Pool) pinger() {
 		}
 	}
 }
+
 func (p *Pool) isClosing() bool {
 	return atomic.LoadInt32(&p.closing) == 1
 }
@@ -1,7 +1,11 @@
 package riago
 
 import (
+	"context"
+	"errors"
 	"math/rand"
+	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -196,3 +200,90 @@ func TestPoolConnectionClosing(t *testing.T) {
 	_, err = p.Get()
 	assert.Equal(ErrPoolClosing, err)
 }
+
+func TestPoolConcurrentDials(t *testing.T) {
+	assert := assert.New(t)
+
+	// Slow and failing dials are made at once, each with a deadline
+	var dials, unbounded int32
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		if _, ok := ctx.Deadline(); !ok {
+			atomic.AddInt32(&unbounded, 1)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		if addr == "down" {
+			return nil, errors.New("connection refused")
+		}
+
+		return fakeDialer(fakeEcho)(ctx, network, addr)
+	}
+
+	start := time.Now()
+	p := NewClusterPool([]string{"up", "down"}, 6, dial)
+	assert.True(time.Now().Sub(start) < 150*time.Millisecond)
+	assert.True(atomic.LoadInt32(&dials) >= 6)
+	assert.Equal(int32(0), atomic.LoadInt32(&unbounded))
+
+	// Failed connections are recovered in the background
+	s := p.Stats()
+	assert.Equal(3, s.Idle)
+	assert.Equal(3, s.Recovering)
+	assert.True(s.DialFailures >= 3)
+}
+
+func TestPoolStats(t *testing.T) {
+	assert := assert.New(t)
+
+	n := 2
+	p := NewPool("127.0.0.1:8087", n)
+	p.waitTimeout = 5 * time.Millisecond
+
+	s := p.Stats()
+	assert.Equal(n, s.Open)
+	assert.Equal(n, s.Idle)
+	assert.Equal(0, s.InUse)
+	assert.Equal(int64(n), s.Dials)
+	assert.Equal(int64(0), s.DialFailures)
+
+	// Check out every connection
+	conns := make([]*Conn, n)
+	for i := 0; i < n; i++ {
+		conns[i], _ = p.Get()
+	}
+
+	s = p.Stats()
+	assert.Equal(0, s.Idle)
+	assert.Equal(n, s.InUse)
+
+	// The next get should wait and time out
+	_, err := p.Get()
+	assert.Equal(ErrPoolWaitTimeout, err)
+
+	s = p.Stats()
+	assert.Equal(int64(1), s.WaitCount)
+	assert.Equal(int64(1), s.WaitTimeouts)
+	assert.True(s.WaitDuration >= p.waitTimeout)
+	assert.Equal(0, s.Waiting)
+
+	// Fail one connection and put back the other
+	conns[0].addr = "127.0.0.1:999999"
+	p.Fail(conns[0])
+	p.Put(conns[1])
+
+	s = p.Stats()
+	assert.Equal(1, s.Recovering)
+	assert.Equal(n-1, s.Open)
+	assert.Equal(1, s.Idle)
+	assert.Equal(0, s.InUse)
+
+	// Wait for a failed recovery attempt to register
+	time.Sleep(10 * time.Millisecond)
+	s = p.Stats()
+	assert.True(s.DialFailures >= 1)
+	assert.True(s.Dials > int64(n))
+
+	err = p.Close()
+	assert.Nil(err)
+}
@@ -7,16 +7,23 @@ import (
 
 // Profile represents the instrumentation artifacts from a single operation.
 type Profile struct {
-	Name     string
-	Object   string
-	Error    error
-	Retries  int32
-	Total    time.Duration
-	ConnWait time.Duration
-	ConnLock time.Duration
-	Request  time.Duration
-	Response time.Duration
-	start    time.Time
+	Name             string
+	Object           string
+	Error            error
+	Retries          int32
+	Total            time.Duration
+	ConnWait         time.Duration
+	ConnLock         time.Duration
+	Request          time.Duration
+	Response         time.Duration
+	Hedges           int32   // Hedged requests issued
+	HedgeWins        int32   // Hedged requests that completed first
+	RetrySkipped     string  // Why a retry the policy wanted was not safe to issue
+	Count            int     // Operations covered by a batch profile
+	Coalesced        bool    // Result was shared from an identical read in flight
+	CompressionRatio float64 // Compressed over uncompressed size of values, if any
+	start            time.Time
+	written          bool
 }
 
 func (p *Profile) String() string {
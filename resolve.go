@@ -0,0 +1,156 @@
+package riago
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// ConflictResolver chooses a single value for an object with siblings.
+type ConflictResolver interface {
+	Resolve(obj *Object) (*Content, error)
+}
+
+// ResolverFunc adapts a merge function to a ConflictResolver.
+type ResolverFunc func(obj *Object) (*Content, error)
+
+func (fn ResolverFunc) Resolve(obj *Object) (*Content, error) {
+	return fn(obj)
+}
+
+// LastModifiedWins resolves conflicts by choosing the most recently modified
+// sibling. Tombstones are ignored unless every sibling is one.
+var LastModifiedWins ConflictResolver = ResolverFunc(func(obj *Object) (*Content, error) {
+	siblings := byLastModified(obj.Siblings)
+	if len(siblings) == 0 {
+		return nil, nil
+	}
+
+	return siblings[len(siblings)-1], nil
+})
+
+// JSONMerge resolves conflicts between JSON object values by merging their
+// fields, recursing into nested objects. Where siblings disagree the most
+// recently modified value wins. Metadata is taken from the most recently
+// modified sibling and tombstones are ignored unless every sibling is one.
+var JSONMerge ConflictResolver = ResolverFunc(func(obj *Object) (c *Content, err error) {
+	siblings := byLastModified(obj.Siblings)
+	if len(siblings) == 0 {
+		return
+	}
+
+	merged := make(map[string]interface{})
+
+	for _, s := range siblings {
+		if len(s.Value) == 0 {
+			continue
+		}
+
+		var v map[string]interface{}
+		if err = json.Unmarshal(s.Value, &v); err != nil {
+			return
+		}
+		mergeJSON(merged, v)
+	}
+
+	latest := *siblings[len(siblings)-1]
+	c = &latest
+	c.Value, err = json.Marshal(merged)
+
+	return
+})
+
+// SetConflictResolver registers the resolver used by FetchObject for objects
+// with siblings in the given bucket type and bucket. An empty bucket applies
+// the resolver to every bucket of the type without its own resolver, and an
+// empty type is the default bucket type. A nil resolver removes it.
+func (c *Client) SetConflictResolver(typ string, bucket string, r ConflictResolver) {
+	if c.resolvers == nil {
+		c.resolvers = make(map[string]ConflictResolver)
+	}
+
+	if r == nil {
+		delete(c.resolvers, typ+"/"+bucket)
+	} else {
+		c.resolvers[typ+"/"+bucket] = r
+	}
+}
+
+// SetConflictWriteBack enables writing resolved values back to Riak with the
+// fetched vclock, collapsing the siblings.
+func (c *Client) SetConflictWriteBack(enabled bool) {
+	c.resolveWriteBack = enabled
+}
+
+// Returns the conflict resolver for a bucket type and bucket, if any.
+func (c *Client) resolverFor(typ string, bucket string) ConflictResolver {
+	if r, ok := c.resolvers[typ+"/"+bucket]; ok {
+		return r
+	}
+
+	return c.resolvers[typ+"/"]
+}
+
+// Resolves an object with siblings using the registered resolver, writing the
+// resolved value back if enabled. Objects without a resolver are unchanged.
+func (c *Client) resolve(obj *Object) (err error) {
+	var content *Content
+
+	r := c.resolverFor(obj.Type, obj.Bucket)
+	if r == nil || !obj.HasSiblings() {
+		return
+	}
+
+	if content, err = r.Resolve(obj); err != nil {
+		return
+	}
+
+	if content == nil {
+		err = ErrUnresolvedSiblings
+		return
+	}
+
+	obj.Siblings = []*Content{content}
+
+	if c.resolveWriteBack {
+		err = c.StoreObject(obj)
+	}
+
+	return
+}
+
+// Returns the siblings sorted from least to most recently modified, ignoring
+// tombstones unless every sibling is one. Ties are ordered by vtag.
+func byLastModified(siblings []*Content) []*Content {
+	sorted := make([]*Content, 0, len(siblings))
+	for _, s := range siblings {
+		if !s.Deleted {
+			sorted = append(sorted, s)
+		}
+	}
+
+	if len(sorted) == 0 {
+		sorted = append(sorted, siblings...)
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].LastModified.Equal(sorted[j].LastModified) {
+			return sorted[i].VTag < sorted[j].VTag
+		}
+		return sorted[i].LastModified.Before(sorted[j].LastModified)
+	})
+
+	return sorted
+}
+
+// Merges the fields of src into dst, recursing into nested objects.
+func mergeJSON(dst map[string]interface{}, src map[string]interface{}) {
+	for k, v := range src {
+		if sv, ok := v.(map[string]interface{}); ok {
+			if dv, ok := dst[k].(map[string]interface{}); ok {
+				mergeJSON(dv, sv)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
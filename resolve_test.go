@@ -0,0 +1,99 @@
+package riago
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLastModifiedWins(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	obj := &Object{Siblings: []*Content{
+		{Value: []byte("new"), LastModified: now},
+		{Value: []byte("old"), LastModified: now.Add(-time.Minute)},
+		{Deleted: true, LastModified: now.Add(time.Minute)},
+	}}
+
+	// Tombstones lose to live values
+	c, err := LastModifiedWins.Resolve(obj)
+	assert.Nil(err)
+	assert.Equal("new", string(c.Value))
+
+	obj.Siblings = obj.Siblings[2:]
+	c, err = LastModifiedWins.Resolve(obj)
+	assert.Nil(err)
+	assert.True(c.Deleted)
+}
+
+func TestResolveJSONMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	obj := &Object{Siblings: []*Content{
+		{Value: []byte(`{"name":"bob","address":{"city":"Paris","zip":"75001"}}`), ContentType: "application/json", LastModified: now},
+		{Value: []byte(`{"name":"robert","age":42,"address":{"city":"Lyon"}}`), LastModified: now.Add(-time.Minute)},
+	}}
+
+	c, err := JSONMerge.Resolve(obj)
+	assert.Nil(err)
+	assert.JSONEq(`{"name":"bob","age":42,"address":{"city":"Paris","zip":"75001"}}`, string(c.Value))
+	assert.Equal("application/json", c.ContentType)
+
+	// Siblings are left untouched
+	assert.Equal(`{"name":"bob","address":{"city":"Paris","zip":"75001"}}`, string(obj.Siblings[0].Value))
+
+	obj.Siblings[1].Value = []byte("not json")
+	_, err = JSONMerge.Resolve(obj)
+	assert.NotNil(err)
+}
+
+func TestClientFetchObjectResolves(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 1, fakeDialer(store.handle))
+
+	store.seed("users", "bob",
+		&RpbContent{Value: []byte("a"), LastMod: proto.Uint32(100)},
+		&RpbContent{Value: []byte("b"), LastMod: proto.Uint32(200)},
+	)
+	req := &RpbGetReq{Bucket: []byte("users"), Key: []byte("bob")}
+
+	// Without a resolver siblings are returned as is
+	obj, err := client.FetchObject(req)
+	assert.Nil(err)
+	assert.Len(obj.Siblings, 2)
+
+	// Resolvers registered for another bucket do not apply
+	client.SetConflictResolver("", "groups", LastModifiedWins)
+	obj, err = client.FetchObject(req)
+	assert.Nil(err)
+	assert.Len(obj.Siblings, 2)
+
+	// Type resolvers apply to every bucket, bucket resolvers take precedence
+	client.SetConflictResolver("", "", LastModifiedWins)
+	obj, err = client.FetchObject(req)
+	assert.Nil(err)
+	assert.Equal("b", string(obj.Content().Value))
+
+	merged := errors.New("merged")
+	client.SetConflictResolver("", "users", ResolverFunc(func(obj *Object) (*Content, error) {
+		return nil, merged
+	}))
+	_, err = client.FetchObject(req)
+	assert.Equal(merged, err)
+
+	// Writing back collapses the siblings
+	client.SetConflictResolver("", "users", nil)
+	client.SetConflictWriteBack(true)
+	obj, err = client.FetchObject(req)
+	assert.Nil(err)
+	assert.Equal("b", string(obj.Content().Value))
+	assert.Len(store.get("users", "bob"), 1)
+	assert.Equal("b", string(store.get("users", "bob")[0].Value))
+}
@@ -0,0 +1,177 @@
+package riago
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetrySkippedNotIdempotent is recorded in Profile.RetrySkipped when a
+// non-idempotent operation failed after its request was written.
+const RetrySkippedNotIdempotent = "non-idempotent request may have been applied"
+
+// Operations that may be applied twice if retried after the request was
+// written, such as counter increments or puts without a key.
+var nonIdempotentOps = map[string]bool{
+	"put":       true,
+	"dt_update": true,
+	"do":        true,
+}
+
+// RetryPolicy decides whether a failed operation should be retried and how
+// long to wait before doing so.
+type RetryPolicy interface {
+	// Retry is called after the given attempt (starting at 1) of the named
+	// operation fails with err. It returns the delay before the next attempt
+	// and whether another attempt should be made at all.
+	Retry(op string, attempt int, err error) (delay time.Duration, ok bool)
+}
+
+// ConstantBackoff retries transient errors up to Attempts times, waiting a
+// fixed Delay between attempts.
+type ConstantBackoff struct {
+	Attempts int
+	Delay    time.Duration
+}
+
+func (b *ConstantBackoff) Retry(op string, attempt int, err error) (time.Duration, bool) {
+	if attempt > b.Attempts || !IsTransient(err) {
+		return 0, false
+	}
+
+	return b.Delay, true
+}
+
+// ExponentialBackoff retries transient errors up to Attempts times, waiting a
+// random delay between zero and Base * 2^(attempt-1), capped at Max
+// ("full jitter").
+type ExponentialBackoff struct {
+	Attempts int
+	Base     time.Duration
+	Max      time.Duration
+}
+
+func (b *ExponentialBackoff) Retry(op string, attempt int, err error) (time.Duration, bool) {
+	if attempt > b.Attempts || !IsTransient(err) {
+		return 0, false
+	}
+
+	return b.delay(attempt), true
+}
+
+// Returns a random delay before the attempt following the given one.
+func (b *ExponentialBackoff) delay(attempt int) time.Duration {
+	ceil := b.Base
+	for i := 1; i < attempt && (b.Max <= 0 || ceil < b.Max); i++ {
+		ceil *= 2
+	}
+	if b.Max > 0 && ceil > b.Max {
+		ceil = b.Max
+	}
+	if ceil <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceil) + 1))
+}
+
+// RetryBudget limits the number of retries relative to successful operations
+// to avoid retry storms when Riak is overloaded. Every retry spends a token
+// and every success earns Ratio tokens, up to Max.
+type RetryBudget struct {
+	max    float64
+	ratio  float64
+	tokens float64
+	mutex  sync.Mutex
+}
+
+// Creates a new RetryBudget holding up to max tokens and earning ratio tokens
+// for each successful operation.
+func NewRetryBudget(max int, ratio float64) *RetryBudget {
+	return &RetryBudget{
+		max:    float64(max),
+		ratio:  ratio,
+		tokens: float64(max),
+	}
+}
+
+// Spend a token, returning false if the budget is exhausted.
+func (b *RetryBudget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens -= 1
+
+	return true
+}
+
+// Earn a fraction of a token for a successful operation.
+func (b *RetryBudget) deposit() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.tokens += b.ratio; b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+// Reports whether an operation can safely be repeated.
+func isIdempotent(op string) bool {
+	return !nonIdempotentOps[op]
+}
+
+// Riak error messages reporting that the cluster could not serve a request
+// at the time, rather than that the request itself is wrong.
+var transientRiakErrors = []string{
+	"overload",
+	"timeout",
+	"all_nodes_down",
+	"insufficient_vnodes",
+	"pr_val_unsatisfied",
+	"pw_val_unsatisfied",
+	"r_val_unsatisfied",
+	"w_val_unsatisfied",
+	"dw_val_unsatisfied",
+}
+
+// IsTransient reports whether an error is likely to succeed when retried:
+// network failures, protocol desyncs, malformed frames and pool wait timeouts
+// are transient, as the request is retried on another connection, as are
+// errors from Riak reporting an overloaded or degraded cluster. Other errors
+// returned by Riak, such as notfound, and request encoding errors are not.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch e := err.(type) {
+	case *RiakError:
+		return isTransientRiakError(e)
+	case *ProtocolError, net.Error:
+		return true
+	}
+
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF, ErrPoolWaitTimeout, ErrPipelineTimeout, ErrEmptyFrame, ErrInvalidResponseCode:
+		return true
+	}
+
+	return false
+}
+
+// Reports whether an error returned by Riak is one of transientRiakErrors.
+func isTransientRiakError(err *RiakError) bool {
+	for _, msg := range transientRiakErrors {
+		if strings.Contains(err.Message, msg) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,190 @@
+package riago
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryIsTransient(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(IsTransient(io.EOF))
+	assert.True(IsTransient(ErrPoolWaitTimeout))
+	assert.True(IsTransient(&ProtocolError{Expected: MsgRpbGetResp, Received: MsgRpbPutResp}))
+	assert.True(IsTransient(ErrEmptyFrame))
+	assert.True(IsTransient(ErrInvalidResponseCode))
+	assert.True(IsTransient(&RiakError{Message: "overload"}))
+	assert.True(IsTransient(&RiakError{Message: "timeout"}))
+	assert.True(IsTransient(&RiakError{Message: "{insufficient_vnodes,0,need,2}"}))
+	assert.True(IsTransient(&RiakError{Message: "{pw_val_unsatisfied,2,1}"}))
+	assert.False(IsTransient(nil))
+	assert.False(IsTransient(ErrPoolClosing))
+	assert.False(IsTransient(&RiakError{Message: "notfound"}))
+	assert.False(IsTransient(&RiakError{Message: "modified"}))
+	assert.False(IsTransient(&RiakError{Message: "{n_val_violation,3}"}))
+	assert.False(IsTransient(errors.New("proto: required field not set")))
+}
+
+func TestRetryExponentialBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	b := &ExponentialBackoff{Attempts: 5, Base: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		ceil := (10 * time.Millisecond) << uint(attempt-1)
+		if ceil > 50*time.Millisecond {
+			ceil = 50 * time.Millisecond
+		}
+
+		for i := 0; i < 100; i++ {
+			delay, ok := b.Retry("get", attempt, io.EOF)
+			assert.True(ok)
+			assert.True(delay >= 0 && delay <= ceil)
+		}
+	}
+
+	// Gives up after the last attempt
+	_, ok := b.Retry("get", 6, io.EOF)
+	assert.False(ok)
+
+	// Never retries semantic errors
+	_, ok = b.Retry("get", 1, &RiakError{Message: "modified"})
+	assert.False(ok)
+}
+
+func TestRetryBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewRetryBudget(2, 0.5)
+	assert.True(b.withdraw())
+	assert.True(b.withdraw())
+	assert.False(b.withdraw())
+
+	// Two successes earn one token
+	b.deposit()
+	assert.False(b.withdraw())
+	b.deposit()
+	assert.True(b.withdraw())
+}
+
+func TestRetryClientPolicies(t *testing.T) {
+	assert := assert.New(t)
+	client := &Client{}
+
+	// Default policy is built from retry attempts and delay
+	client.SetRetryAttempts(2)
+	client.SetRetryDelay(time.Millisecond)
+
+	calls := 0
+	prof := NewProfile("get", "")
+	err := client.retry(func() error {
+		calls += 1
+		return io.EOF
+	}, prof)
+	assert.Equal(io.EOF, err)
+	assert.Equal(3, calls)
+	assert.Equal(int32(2), prof.Retries)
+
+	// Does not retry semantic errors
+	calls = 0
+	prof = NewProfile("get", "")
+	err = client.retry(func() error {
+		calls += 1
+		return &RiakError{Message: "notfound"}
+	}, prof)
+	assert.NotNil(err)
+	assert.Equal(1, calls)
+	assert.Equal(int32(0), prof.Retries)
+
+	// Per-operation overrides take precedence
+	client.SetRetryPolicy(&ConstantBackoff{Attempts: 1})
+	client.SetOperationRetryPolicy("put", &ConstantBackoff{Attempts: 0})
+
+	calls = 0
+	client.retry(func() error {
+		calls += 1
+		return io.EOF
+	}, NewProfile("get", ""))
+	assert.Equal(2, calls)
+
+	calls = 0
+	client.retry(func() error {
+		calls += 1
+		return io.EOF
+	}, NewProfile("put", ""))
+	assert.Equal(1, calls)
+
+	// The budget stops retries once exhausted
+	client.SetRetryPolicy(&ConstantBackoff{Attempts: 10})
+	client.SetRetryBudget(NewRetryBudget(3, 0.1))
+
+	calls = 0
+	client.retry(func() error {
+		calls += 1
+		return io.EOF
+	}, NewProfile("get", ""))
+	assert.Equal(4, calls)
+}
+
+func TestRetryNoSleepAfterFinalAttempt(t *testing.T) {
+	assert := assert.New(t)
+	client := &Client{}
+	client.SetRetryPolicy(&ConstantBackoff{Attempts: 0, Delay: time.Second})
+
+	t0 := time.Now()
+	client.retry(func() error { return io.EOF }, NewProfile("get", ""))
+	assert.True(time.Now().Sub(t0) < 100*time.Millisecond)
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	assert := assert.New(t)
+	client := &Client{}
+	client.SetRetryPolicy(&ConstantBackoff{Attempts: 3})
+
+	// Fails after the request was written
+	calls := 0
+	prof := NewProfile("dt_update", "")
+	err := client.retry(func() error {
+		calls += 1
+		prof.written = true
+		return io.ErrUnexpectedEOF
+	}, prof)
+	assert.Equal(io.ErrUnexpectedEOF, err)
+	assert.Equal(1, calls)
+	assert.Equal(RetrySkippedNotIdempotent, prof.RetrySkipped)
+
+	// Fails before the request was written
+	calls = 0
+	prof = NewProfile("dt_update", "")
+	client.retry(func() error {
+		calls += 1
+		return ErrPoolWaitTimeout
+	}, prof)
+	assert.Equal(4, calls)
+	assert.Equal("", prof.RetrySkipped)
+
+	// Idempotent operations are always retried
+	calls = 0
+	prof = NewProfile("get", "")
+	client.retry(func() error {
+		calls += 1
+		prof.written = true
+		return io.ErrUnexpectedEOF
+	}, prof)
+	assert.Equal(4, calls)
+
+	// Unsafe retries can be opted into
+	client.SetRetryNonIdempotent(true)
+	calls = 0
+	prof = NewProfile("put", "")
+	client.retry(func() error {
+		calls += 1
+		prof.written = true
+		return io.ErrUnexpectedEOF
+	}, prof)
+	assert.Equal(4, calls)
+}
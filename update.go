@@ -0,0 +1,106 @@
+package riago
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// DefaultUpdateBackoff is used by Update when no update backoff is set.
+var DefaultUpdateBackoff = ExponentialBackoff{Attempts: 5, Base: 10 * time.Millisecond, Max: 500 * time.Millisecond}
+
+// UpdateConflictError is returned by Update when the object was modified
+// concurrently on every attempt.
+type UpdateConflictError struct {
+	Type     string // Bucket type, empty for the default type
+	Bucket   string
+	Key      string
+	Attempts int
+	Err      error // Conflict reported by the final attempt
+}
+
+func (e *UpdateConflictError) Error() string {
+	return fmt.Sprintf("update of %s/%s gave up after %d attempts: %v", e.Bucket, e.Key, e.Attempts, e.Err)
+}
+
+// SetUpdateBackoff establishes how many times Update starts over after a
+// conflict and how long it waits before doing so.
+func (c *Client) SetUpdateBackoff(b *ExponentialBackoff) {
+	c.updateBackoff = b
+}
+
+// Update performs a read-modify-write of an object with optimistic
+// concurrency. The object is fetched and its siblings resolved (see
+// SetConflictResolver) before it is passed to fn, which mutates it. The
+// object is then stored with its vclock and if_not_modified (or if_none_match
+// if it did not exist). Should another writer modify the object in between,
+// the update starts over after a backoff, returning an *UpdateConflictError
+// once the attempts are exhausted. Errors returned by fn abort the update.
+func (c *Client) Update(bucket string, key string, fn func(*Object) error) (obj *Object, err error) {
+	return c.UpdateType("", bucket, key, fn)
+}
+
+// UpdateType performs a read-modify-write of an object in the given bucket
+// type (see Update). An empty type uses the default bucket type.
+func (c *Client) UpdateType(typ string, bucket string, key string, fn func(*Object) error) (obj *Object, err error) {
+	var req *RpbPutReq
+
+	backoff := c.updateBackoff
+	if backoff == nil {
+		backoff = &DefaultUpdateBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		getReq := &RpbGetReq{Bucket: []byte(bucket), Key: []byte(key)}
+		if typ != "" {
+			getReq.Type = []byte(typ)
+		}
+
+		if obj, err = c.FetchObject(getReq); err != nil {
+			return
+		}
+
+		if obj.HasSiblings() {
+			err = ErrUnresolvedSiblings
+			return
+		}
+
+		if err = fn(obj); err != nil {
+			return
+		}
+
+		if req, err = obj.putReq(); err != nil {
+			return
+		}
+
+		if len(obj.VClock) > 0 {
+			req.IfNotModified = proto.Bool(true)
+		} else {
+			req.IfNoneMatch = proto.Bool(true)
+		}
+
+		if err = c.storeObject(obj, req); err == nil || !isUpdateConflict(err) {
+			return
+		}
+
+		if attempt > backoff.Attempts {
+			err = &UpdateConflictError{Type: typ, Bucket: bucket, Key: key, Attempts: attempt, Err: err}
+			return
+		}
+
+		if delay := backoff.delay(attempt); delay > 0 {
+			<-time.After(delay)
+		}
+	}
+}
+
+// Reports whether Riak rejected a conditional store because the object was
+// modified or created concurrently.
+func isUpdateConflict(err error) bool {
+	if e, ok := err.(*RiakError); ok {
+		return e.Message == "modified" || e.Message == "match_found"
+	}
+
+	return false
+}
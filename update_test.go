@@ -0,0 +1,108 @@
+package riago
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// Increments a decimal counter stored as the object value.
+func increment(obj *Object) error {
+	n, _ := strconv.Atoi(string(obj.Content().Value))
+	obj.Content().Value = []byte(strconv.Itoa(n + 1))
+	return nil
+}
+
+func TestClientUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	client := NewClientWithDialer("riak", 4, fakeDialer(store.handle))
+	client.SetUpdateBackoff(&ExponentialBackoff{Attempts: 100, Base: time.Millisecond, Max: 5 * time.Millisecond})
+
+	// Concurrent updates conflict but none are lost
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Update("counters", "hits", increment)
+			assert.Nil(err)
+		}()
+	}
+	wg.Wait()
+
+	content := store.get("counters", "hits")
+	assert.Len(content, 1)
+	assert.Equal("20", string(content[0].Value))
+
+	obj, err := client.Update("counters", "hits", increment)
+	assert.Nil(err)
+	assert.Equal("21", string(obj.Content().Value))
+	assert.NotEmpty(obj.VClock)
+
+	// Updates read and write the object in its bucket type
+	var types []string
+	client.AddInterceptor(func(call *Call, next Invoker) error {
+		switch req := call.Req.(type) {
+		case *RpbGetReq:
+			types = append(types, string(req.GetType()))
+		case *RpbPutReq:
+			types = append(types, string(req.GetType()))
+		}
+		return next(call)
+	})
+
+	obj, err = client.UpdateType("maps", "counters", "typed", increment)
+	assert.Nil(err)
+	assert.Equal("maps", obj.Type)
+	assert.Equal("1", string(obj.Content().Value))
+	assert.Equal([]string{"maps", "maps"}, types)
+
+	// Mutation errors abort the update
+	aborted := errors.New("aborted")
+	_, err = client.Update("counters", "hits", func(obj *Object) error {
+		return aborted
+	})
+	assert.Equal(aborted, err)
+}
+
+func TestClientUpdateGivesUp(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newFakeStore()
+	store.seed("counters", "hits", &RpbContent{Value: []byte("1")})
+
+	var mutex sync.Mutex
+	puts := 0
+	client := NewClientWithDialer("riak", 1, fakeDialer(func(addr string, code byte, body []byte, reply func(byte, []byte)) {
+		if code == MsgRpbPutReq {
+			mutex.Lock()
+			puts += 1
+			mutex.Unlock()
+			reply(MsgRpbErrorResp, mustMarshal(&RpbErrorResp{Errmsg: []byte("modified"), Errcode: proto.Uint32(0)}))
+			return
+		}
+		store.handle(addr, code, body, reply)
+	}))
+	client.SetUpdateBackoff(&ExponentialBackoff{Attempts: 2, Base: time.Millisecond})
+
+	_, err := client.Update("counters", "hits", increment)
+	assert.Equal(&UpdateConflictError{
+		Bucket:   "counters",
+		Key:      "hits",
+		Attempts: 3,
+		Err:      &RiakError{Message: "modified"},
+	}, err)
+	assert.Equal(3, puts)
+
+	// Unresolved siblings are not overwritten
+	store.seed("counters", "hits", &RpbContent{Value: []byte("1")}, &RpbContent{Value: []byte("2")})
+	_, err = client.Update("counters", "hits", increment)
+	assert.Equal(ErrUnresolvedSiblings, err)
+}